@@ -0,0 +1,263 @@
+package spider
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x-funs/go-fun"
+)
+
+// CacheStore 响应缓存存储
+type CacheStore interface {
+	// Get 获取缓存, 不存在时返回 false
+	Get(key string) (*CacheEntry, bool)
+
+	// Set 保存缓存
+	Set(key string, entry *CacheEntry)
+
+	// Delete 删除缓存
+	Delete(key string)
+}
+
+// CacheEntry 缓存的响应, Body 为字符集转换前的响应体
+type CacheEntry struct {
+	// 最后请求地址
+	RequestURL string
+
+	// Http 状态码
+	StatusCode int
+
+	// 响应头
+	Headers http.Header
+
+	// 响应体
+	Body []byte
+
+	// ETag 响应头
+	ETag string
+
+	// Last-Modified 响应头
+	LastModified string
+
+	// 缓存时间
+	StoredAt time.Time
+}
+
+// cacheKey 缓存 key, 仅缓存 GET 请求
+func cacheKey(req *http.Request) string {
+	if req.Method != "" && req.Method != http.MethodGet {
+		return ""
+	}
+
+	return req.URL.String()
+}
+
+// cacheRequest 为请求添加条件请求头
+func cacheRequest(req *http.Request, entry *CacheEntry) {
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// cacheEntry 根据响应创建缓存, 没有 ETag、Last-Modified 或禁止缓存时返回 nil
+func cacheEntry(resp *fun.HttpResp) *CacheEntry {
+	if resp == nil || !resp.Success || resp.Headers == nil {
+		return nil
+	}
+
+	headers := *resp.Headers
+	etag := headers.Get("ETag")
+	lastModified := headers.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+	if strings.Contains(strings.ToLower(headers.Get("Cache-Control")), "no-store") {
+		return nil
+	}
+
+	entry := &CacheEntry{
+		StatusCode:   resp.StatusCode,
+		Headers:      headers.Clone(),
+		Body:         append([]byte(nil), resp.Body...),
+		ETag:         etag,
+		LastModified: lastModified,
+		StoredAt:     time.Now(),
+	}
+	if resp.RequestURL != nil {
+		entry.RequestURL = resp.RequestURL.String()
+	}
+
+	return entry
+}
+
+// cacheResp 根据缓存创建响应
+func cacheResp(entry *CacheEntry, requestURL *url.URL) *fun.HttpResp {
+	headers := entry.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+
+	if u, err := url.Parse(entry.RequestURL); err == nil && entry.RequestURL != "" {
+		requestURL = u
+	}
+
+	return &fun.HttpResp{
+		Success:       true,
+		StatusCode:    entry.StatusCode,
+		Body:          append([]byte(nil), entry.Body...),
+		ContentLength: int64(len(entry.Body)),
+		Headers:       &headers,
+		RequestURL:    requestURL,
+	}
+}
+
+// MemoryCacheStore 内存 LRU 缓存
+type MemoryCacheStore struct {
+	mu sync.Mutex
+
+	// 最大缓存数量
+	maxEntries int
+
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCacheStore 初始化内存 LRU 缓存, maxEntries <= 0 时不限制数量
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, exists := s.items[key]; exists {
+		s.ll.MoveToFront(e)
+		return e.Value.(*memoryCacheItem).entry, true
+	}
+
+	return nil, false
+}
+
+func (s *MemoryCacheStore) Set(key string, entry *CacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, exists := s.items[key]; exists {
+		s.ll.MoveToFront(e)
+		e.Value.(*memoryCacheItem).entry = entry
+		return
+	}
+
+	s.items[key] = s.ll.PushFront(&memoryCacheItem{key: key, entry: entry})
+
+	if s.maxEntries > 0 && s.ll.Len() > s.maxEntries {
+		if e := s.ll.Back(); e != nil {
+			s.ll.Remove(e)
+			delete(s.items, e.Value.(*memoryCacheItem).key)
+		}
+	}
+}
+
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, exists := s.items[key]; exists {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+// Len 返回缓存数量
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ll.Len()
+}
+
+// DirCacheStore 磁盘目录缓存, 每个缓存一个文件, 文件名为 key 的 sha1
+type DirCacheStore struct {
+	dir string
+}
+
+// NewDirCacheStore 初始化磁盘目录缓存, 目录不存在时创建
+func NewDirCacheStore(dir string) (*DirCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &DirCacheStore{dir: dir}, nil
+}
+
+func (s *DirCacheStore) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *DirCacheStore) Get(key string) (*CacheEntry, bool) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry CacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return nil, false
+	}
+
+	return &entry, true
+}
+
+func (s *DirCacheStore) Set(key string, entry *CacheEntry) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return
+	}
+
+	// 先写临时文件再重命名, 避免读到不完整的文件
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+func (s *DirCacheStore) Delete(key string) {
+	_ = os.Remove(s.path(key))
+}
@@ -0,0 +1,165 @@
+package spider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestCacheServer(full *int32) *httptest.Server {
+	lastModified := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/modified":
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", lastModified)
+		case "/nostore":
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Cache-Control", "no-store")
+		case "/home":
+			if r.Header.Get("If-None-Match") == `"home"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			atomic.AddInt32(full, 1)
+			w.Header().Set("ETag", `"home"`)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(testHomeHtml()))
+			return
+		}
+
+		atomic.AddInt32(full, 1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<html><head><title>缓存测试</title></head><body>" + r.URL.Path + "</body></html>"))
+	}))
+}
+
+func TestHttpGetRespCache(t *testing.T) {
+	var full int32
+	ts := newTestCacheServer(&full)
+	defer ts.Close()
+
+	req := &HttpReq{Cache: NewMemoryCacheStore(10)}
+
+	for _, path := range []string{"/etag", "/modified"} {
+		atomic.StoreInt32(&full, 0)
+
+		resp, err := HttpGetResp(ts.URL+path, req, 5000)
+		if err != nil || resp.FromCache {
+			t.Fatalf("want fresh response, got %v %v", resp.FromCache, err)
+		}
+
+		resp, err = HttpGetResp(ts.URL+path, req, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.FromCache || resp.StatusCode != http.StatusOK || resp.Charset.Charset != "UTF-8" {
+			t.Errorf("%s want from cache, got %v %d %v", path, resp.FromCache, resp.StatusCode, resp.Charset)
+		}
+		if string(resp.Body) != "<html><head><title>缓存测试</title></head><body>"+path+"</body></html>" {
+			t.Errorf("unexpected cached body %s", resp.Body)
+		}
+		if full != 1 {
+			t.Errorf("%s want 1 full response, got %d", path, full)
+		}
+	}
+
+	// 没有校验信息的响应不缓存
+	atomic.StoreInt32(&full, 0)
+	for i := 0; i < 2; i++ {
+		if resp, err := HttpGetResp(ts.URL+"/none", req, 5000); err != nil || resp.FromCache {
+			t.Errorf("want fresh response, got %v %v", resp.FromCache, err)
+		}
+	}
+	if full != 2 {
+		t.Errorf("want 2 full responses, got %d", full)
+	}
+
+	// 资源不再提供校验信息或禁止缓存时删除旧的缓存
+	for _, path := range []string{"/none", "/nostore"} {
+		req.Cache.Set(ts.URL+path, &CacheEntry{ETag: `"old"`, Body: []byte("old")})
+		if resp, err := HttpGetResp(ts.URL+path, req, 5000); err != nil || resp.FromCache {
+			t.Errorf("%s want fresh response, got %v %v", path, resp.FromCache, err)
+		}
+		if _, exists := req.Cache.Get(ts.URL + path); exists {
+			t.Errorf("%s want stale entry deleted", path)
+		}
+	}
+}
+
+func TestMemoryCacheStore(t *testing.T) {
+	s := NewMemoryCacheStore(2)
+	s.Set("a", &CacheEntry{ETag: "a"})
+	s.Set("b", &CacheEntry{ETag: "b"})
+	s.Get("a")
+	s.Set("c", &CacheEntry{ETag: "c"})
+
+	if _, exists := s.Get("b"); exists {
+		t.Error("want b evicted")
+	}
+	if entry, exists := s.Get("a"); !exists || entry.ETag != "a" {
+		t.Error("want a cached")
+	}
+	s.Delete("a")
+	if s.Len() != 1 {
+		t.Errorf("want 1 entry, got %d", s.Len())
+	}
+}
+
+func TestDirCacheStore(t *testing.T) {
+	s, err := NewDirCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &CacheEntry{
+		RequestURL: "http://www.example.com/",
+		StatusCode: 200,
+		Headers:    http.Header{"Etag": []string{`"v1"`}},
+		Body:       []byte("body"),
+		ETag:       `"v1"`,
+		StoredAt:   time.Now(),
+	}
+	s.Set("http://www.example.com/", entry)
+
+	got, exists := s.Get("http://www.example.com/")
+	if !exists || got.ETag != entry.ETag || string(got.Body) != "body" || got.Headers.Get("ETag") != `"v1"` {
+		t.Errorf("unexpected entry %+v", got)
+	}
+
+	s.Delete("http://www.example.com/")
+	if _, exists := s.Get("http://www.example.com/"); exists {
+		t.Error("want entry deleted")
+	}
+}
+
+func TestGetLinkDataWithCache(t *testing.T) {
+	var full int32
+	ts := newTestCacheServer(&full)
+	defer ts.Close()
+
+	store, _ := NewDirCacheStore(t.TempDir())
+	req := &HttpReq{Cache: store}
+
+	for i := 0; i < 3; i++ {
+		if _, err := GetLinkDataWithReq(ts.URL+"/home", false, req, 5000, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if full != 1 {
+		t.Errorf("want 1 full response, got %d", full)
+	}
+}
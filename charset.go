@@ -1,13 +1,20 @@
 package spider
 
 import (
+	"bytes"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/suosi-inc/chardet"
 	"github.com/x-funs/go-fun"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
 )
 
 const (
@@ -15,12 +22,17 @@ const (
 	CharsetPosHtml   = "html"
 	CharsetPosGuess  = "guess"
 	CharsetPosValid  = "valid"
+	CharsetPosBom    = "bom"
+	CharsetPosRepair = "repair"
+	CharsetPosXml    = "xml"
+	CharsetPosJson   = "json"
+	CharsetPosCss    = "css"
 )
 
 const (
-	RegexCharset      = "(?i)charset=\\s*([a-z][_\\-0-9a-z]*)"
+	RegexCharset      = "(?i)charset=\\s*([a-z0-9][_\\-.:0-9a-z]*)"
 	RegexCharsetHtml4 = "(?i)<meta\\s+([^>]*http-equiv=(\"|')?content-type(\"|')?[^>]*)>"
-	RegexCharsetHtml5 = "(?i)<meta\\s+charset\\s*=\\s*[\"']?([a-z][_\\-0-9a-z]*)[^>]*>"
+	RegexCharsetHtml5 = "(?i)<meta\\s+charset\\s*=\\s*[\"']?([a-z0-9][_\\-.:0-9a-z]*)[^>]*>"
 )
 
 var (
@@ -29,59 +41,163 @@ var (
 	regexCharsetHtml5Pattern = regexp.MustCompile(RegexCharsetHtml5)
 )
 
+// charsetBoms BOM 对应的字符集, UTF-32LE 需要在 UTF-16LE 之前匹配
+var charsetBoms = []struct {
+	bom     []byte
+	charset string
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "UTF-8"},
+	{[]byte{0xFF, 0xFE, 0x00, 0x00}, "UTF-32LE"},
+	{[]byte{0x00, 0x00, 0xFE, 0xFF}, "UTF-32BE"},
+	{[]byte{0xFF, 0xFE}, "UTF-16LE"},
+	{[]byte{0xFE, 0xFF}, "UTF-16BE"},
+}
+
+const (
+	// CharsetTrialCount 试解码的候选字符集数量
+	CharsetTrialCount = 3
+
+	// CharsetDetectLength 探测候选字符集时使用的最大长度
+	CharsetDetectLength = 64 * 1024
+)
+
 type CharsetRes struct {
 	Charset    string
 	CharsetPos string
+
+	// 置信度, 范围 0-100
+	Confidence int
+
+	// 响应头声明的字符集
+	HeaderCharset string
+
+	// HTML 声明的字符集
+	HtmlCharset string
+
+	// XML 声明的字符集
+	XmlCharset string
+
+	// CSS @charset 声明的字符集
+	CssCharset string
+
+	// 猜测的候选字符集, 按替换字符数量、置信度排序, 仅在未声明字符集或修复时探测
+	// 修复时为修复片段使用的候选字符集, 声明的非 UTF-8 字符集在最前
+	Candidates []CharsetCandidate
+
+	// 修复的字节数, 仅在 CharsetPos 为 CharsetPosRepair 时不为 0
+	RepairedBytes int
+}
+
+// CharsetCandidate 候选字符集
+type CharsetCandidate struct {
+	// 字符集
+	Charset string
+
+	// chardet 置信度, 范围 0-100
+	Confidence int
+
+	// 试解码产生的替换字符数量, 未试解码时为 -1
+	Replacements int
 }
 
 // Charset 解析 HTTP body、http.Header 中的编码和语言, 如果未解析成功则尝试进行猜测
+// 优先级依次为 BOM、没有 BOM 的 UTF-16/32 JSON 和 XML、有效的 UTF-8、修复、响应头和文档声明、猜测
+// 文档声明依次为 HTML meta、XML 声明、CSS @charset, 响应头为 XML 类型时优先使用 XML 声明
+// 大部分非 ASCII 字节为有效的 UTF-8 时认为是混合编码, 字符集为 UTF-8, 其他编码的片段由 CharsetRepair 修复
+// 猜测时对前 CharsetTrialCount 个候选字符集试解码, 优先使用替换字符最少的字符集
 func Charset(body []byte, headers *http.Header) CharsetRes {
 	var charsetRes CharsetRes
-	var guessCharset string
 
-	// 优先检测是否是有效的 UTF-8
+	// BOM 优先级最高
+	if charset, _ := CharsetFromBom(body); charset != "" {
+		charsetRes.Charset = charset
+		charsetRes.CharsetPos = CharsetPosBom
+		charsetRes.Confidence = 100
+		return charsetRes
+	}
+
+	// 没有 BOM 的 UTF-16/32 JSON、XML
+	if charset, pos := charsetFromUnicode(body, headers); charset != "" {
+		charsetRes.Charset = charset
+		charsetRes.CharsetPos = pos
+		charsetRes.Confidence = 100
+		return charsetRes
+	}
+
+	// 检测是否是有效的 UTF-8
 	valid := utf8.Valid(body)
 	if valid {
 		charsetRes.Charset = "UTF-8"
 		charsetRes.CharsetPos = CharsetPosValid
+		charsetRes.Confidence = 100
 		return charsetRes
 	}
 
+	// 混合编码, 例如 UTF-8 页面中包含 GBK 编码的页脚或广告
+	if repairRes, ok := charsetRepairRes(body, headers); ok {
+		return repairRes
+	}
+
 	// 根据 Content-Type、Body Html 标签探测编码
 	charsetRes = CharsetFromHeaderHtml(body, headers)
 
 	// 未识别到 charset 则使用 guess
 	if charsetRes.Charset == "" {
-		guessCharset = CharsetGuess(body)
-
-		if guessCharset != "" {
-			charsetRes.Charset = guessCharset
+		candidates := CharsetCandidates(body)
+		if len(candidates) > 0 {
+			charsetRes.Charset = candidates[0].Charset
 			charsetRes.CharsetPos = CharsetPosGuess
+			charsetRes.Confidence = candidates[0].Confidence
+			charsetRes.Candidates = candidates
 		}
 	}
 
 	return charsetRes
 }
 
+// CharsetFromBom 根据 BOM 识别 UTF-8、UTF-16LE/BE、UTF-32LE/BE, 返回字符集和 BOM 长度, 没有 BOM 时返回空字符串
+func CharsetFromBom(body []byte) (string, int) {
+	for _, b := range charsetBoms {
+		if bytes.HasPrefix(body, b.bom) {
+			return b.charset, len(b.bom)
+		}
+	}
+
+	return "", 0
+}
+
 // CharsetFromHeaderHtml 解析 HTTP body、http.Header 中的 charset, 准确性高
+// body 中依次解析 HTML meta、XML 声明、CSS @charset, 响应头为 XML 类型时优先使用 XML 声明
 func CharsetFromHeaderHtml(body []byte, headers *http.Header) CharsetRes {
 	var res CharsetRes
 
 	cHeader := CharsetFromHeader(headers)
 
-	cHtml := CharsetFromHtml(body)
+	cHtml, htmlPos := charsetFromDoc(body, headers)
+
+	res.HeaderCharset = cHeader
+	switch htmlPos {
+	case CharsetPosHtml:
+		res.HtmlCharset = cHtml
+	case CharsetPosXml:
+		res.XmlCharset = cHtml
+	case CharsetPosCss:
+		res.CssCharset = cHtml
+	}
 
 	// 只有 Header 则使用 Header
 	if cHeader != "" && cHtml == "" {
 		res.Charset = cHeader
 		res.CharsetPos = CharsetPosHeader
+		res.Confidence = 90
 		return res
 	}
 
 	// 只有 Html 则使用 Html
 	if cHeader == "" && cHtml != "" {
 		res.Charset = cHtml
-		res.CharsetPos = CharsetPosHtml
+		res.CharsetPos = htmlPos
+		res.Confidence = 90
 		return res
 	}
 
@@ -90,13 +206,17 @@ func CharsetFromHeaderHtml(body []byte, headers *http.Header) CharsetRes {
 		if cHeader == cHtml {
 			res.Charset = cHeader
 			res.CharsetPos = CharsetPosHeader
+			res.Confidence = 100
 			return res
 		}
 
+		// Header 和 Html 不一致, 置信度降低
+		res.Confidence = 70
+
 		// Header 和 Html 不一致, 以下情况以 Html 为准
 		if strings.HasPrefix(cHeader, "ISO") || strings.HasPrefix(cHeader, "WINDOWS") {
 			res.Charset = cHtml
-			res.CharsetPos = CharsetPosHtml
+			res.CharsetPos = htmlPos
 			return res
 		}
 
@@ -186,37 +306,126 @@ func CharsetGuess(body []byte) string {
 	detector := chardet.NewHtmlDetector()
 	guess, err := detector.DetectBest(body)
 	if err == nil {
-		guessCharset = strings.ToUpper(guess.Charset)
+		guessCharset = convertCharset(guess.Charset)
 	}
 
 	return guessCharset
 }
 
-// convertCharset 格式化 charset
-func convertCharset(charset string) string {
-	c := strings.ToUpper(strings.TrimSpace(charset))
+// CharsetCandidates 根据 HTTP body 猜测候选字符集, 对前 CharsetTrialCount 个以及与第 CharsetTrialCount 个置信度相同的候选字符集试解码
+// 按替换字符数量从少到多、置信度从高到低、常用字符数量从多到少排序
+func CharsetCandidates(body []byte) []CharsetCandidate {
+	truncated := len(body) > CharsetDetectLength
+	if truncated {
+		body = body[:CharsetDetectLength]
+	}
 
-	if c != "" {
-		// alias utf8
-		if c == "UTF8" || c == "UTF_8" {
-			return "UTF-8"
+	detector := chardet.NewHtmlDetector()
+	results, err := detector.DetectAll(body)
+	if err != nil {
+		return nil
+	}
+
+	// chardet 的结果顺序不稳定, 先按置信度和 charsetPriority 排序, 保证试解码的候选字符集固定
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Confidence != results[j].Confidence {
+			return results[i].Confidence > results[j].Confidence
+		}
+		return charsetRank(convertCharset(results[i].Charset)) < charsetRank(convertCharset(results[j].Charset))
+	})
+
+	var candidates []CharsetCandidate
+	var trialCount int
+	seen := make(map[string]bool)
+	for _, result := range results {
+		c := convertCharset(result.Charset)
+		if c == "" || seen[c] {
+			continue
 		}
+		seen[c] = true
 
-		// alias gb2312, gb18030
-		if strings.HasPrefix(c, "GB") {
-			return "GBK"
+		candidate := CharsetCandidate{Charset: c, Confidence: result.Confidence, Replacements: -1}
+		if len(candidates) == trialCount && (trialCount < CharsetTrialCount || candidates[trialCount-1].Confidence == candidate.Confidence) {
+			candidate.Replacements = charsetReplacements(body, c, truncated)
+			trialCount++
 		}
+		candidates = append(candidates, candidate)
+	}
 
-		// alias big5-hkscs..
-		if strings.HasPrefix(c, "BIG5") {
-			return "Big5"
+	// 只对试解码的候选字符集重新排序, 替换字符数量和置信度相同时常用字符多的优先, 仍然相同时按 charsetPriority
+	trial := candidates[:trialCount]
+	commons := make(map[string]int)
+	common := func(charset string) int {
+		if n, exists := commons[charset]; exists {
+			return n
+		}
+		n := charsetCommonRunes(body, charset)
+		commons[charset] = n
+		return n
+	}
+	sort.SliceStable(trial, func(i, j int) bool {
+		a, b := trial[i], trial[j]
+		if a.Replacements != b.Replacements {
+			return a.Replacements < b.Replacements
+		}
+		if a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if ca, cb := common(a.Charset), common(b.Charset); ca != cb {
+			return ca > cb
 		}
+		return charsetRank(a.Charset) < charsetRank(b.Charset)
+	})
 
-		// alias shift-jis
-		if strings.HasPrefix(c, "SHIFT") {
-			return "SHIFT_JIS"
+	return candidates
+}
+
+// charsetReplacements 试解码并返回替换字符数量, 无法解码时返回 body 长度
+// truncated 为 true 时忽略末尾被截断的字符
+func charsetReplacements(body []byte, charset string, truncated bool) int {
+	utf8Body, err := charsetDecode(body, charset)
+	if err != nil {
+		return len(body)
+	}
+
+	if truncated {
+		utf8Body = bytes.TrimRight(utf8Body, string(utf8.RuneError))
+	}
+
+	return bytes.Count(utf8Body, []byte(string(utf8.RuneError)))
+}
+
+// charsetEncoding 返回字符集对应的 encoding.Encoding
+func charsetEncoding(charset string) (encoding.Encoding, error) {
+	switch strings.ToUpper(charset) {
+	case "UTF-16LE":
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), nil
+	case "UTF-16BE":
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), nil
+	case "UTF-32LE":
+		return utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM), nil
+	case "UTF-32BE":
+		return utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM), nil
+	}
+
+	// IANA 不支持的 WHATWG 规范名称, 如 WINDOWS-874、X-MAC-CYRILLIC
+	e, err := ianaindex.MIME.Encoding(charset)
+	if err != nil || e == nil {
+		e, err = htmlindex.Get(charset)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return c
+	return e, nil
+}
+
+// charsetDecode 将 body 按字符集转换为 UTF-8
+func charsetDecode(body []byte, charset string) ([]byte, error) {
+	e, err := charsetEncoding(charset)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.NewDecoder().Bytes(body)
 }
@@ -0,0 +1,69 @@
+package spider
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// charsetPriority 候选字符集置信度、替换字符数量、常用字符数量都相同时的优先顺序, 不在其中的字符集排在最后
+var charsetPriority = []string{"UTF-8", "GBK", "Big5", "SHIFT_JIS", "EUC-JP", "EUC-KR", "GB18030"}
+
+// charsetRank 返回字符集在 charsetPriority 中的位置
+func charsetRank(charset string) int {
+	for i, c := range charsetPriority {
+		if c == charset {
+			return i
+		}
+	}
+
+	return len(charsetPriority)
+}
+
+// charsetCommonRunes 按 charset 解码后常用字符的数量, 用于区分都能无替换字符解码的双字节编码
+// 常用字符为假名、GB2312 一级汉字、JIS X 0208 第一水准汉字和 Big5 常用字, 错误的编码解码后通常是生僻字或半角片假名
+func charsetCommonRunes(body []byte, charset string) int {
+	utf8Body, err := charsetDecode(body, charset)
+	if err != nil {
+		return 0
+	}
+
+	gbk := simplifiedchinese.GBK.NewEncoder()
+	sjis := japanese.ShiftJIS.NewEncoder()
+	big5 := traditionalchinese.Big5.NewEncoder()
+
+	var n int
+	for _, r := range string(utf8Body) {
+		switch {
+		case r < 0x3040:
+			continue
+		case r <= 0x30FF:
+			// 平假名、片假名
+			n++
+		case charsetCommonRune(gbk, r, 0xB0A1, 0xD7F9, 0xA1),
+			charsetCommonRune(sjis, r, 0x889F, 0x9872, 0x40),
+			charsetCommonRune(big5, r, 0xA440, 0xC67E, 0x40):
+			n++
+		}
+	}
+
+	return n
+}
+
+// charsetCommonRune 判断 r 按 encoder 编码后是否为 [min, max] 范围内、尾字节不小于 minTrail 的双字节编码
+func charsetCommonRune(encoder *encoding.Encoder, r rune, min, max int, minTrail byte) bool {
+	var src [4]byte
+	var dst [8]byte
+
+	encoder.Reset()
+	nDst, _, err := encoder.Transform(dst[:], src[:utf8.EncodeRune(src[:], r)], true)
+	if err != nil || nDst != 2 || dst[1] < minTrail {
+		return false
+	}
+
+	code := int(dst[0])<<8 | int(dst[1])
+	return code >= min && code <= max
+}
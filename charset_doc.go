@@ -0,0 +1,186 @@
+package spider
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	RegexCharsetXml = "(?i)^\\s*<\\?xml\\s[^>]*?encoding\\s*=\\s*[\"']([a-z0-9][_\\-.:0-9a-z]*)[\"']"
+	RegexCharsetCss = "(?i)^@charset \"([a-z0-9][_\\-.:0-9a-z]*)\";"
+
+	// charsetDocLength 识别 XML 声明、CSS @charset 的最大长度
+	charsetDocLength = 1024
+)
+
+var (
+	regexCharsetXmlPattern = regexp.MustCompile(RegexCharsetXml)
+	regexCharsetCssPattern = regexp.MustCompile(RegexCharsetCss)
+)
+
+// charsetXmlPrefixes 没有 BOM 时根据 XML 声明 "<?" 的字节识别 UTF-16/32, 参考 XML 规范附录 F
+var charsetXmlPrefixes = []struct {
+	prefix  []byte
+	charset string
+}{
+	{[]byte{0x00, 0x00, 0x00, 0x3C}, "UTF-32BE"},
+	{[]byte{0x3C, 0x00, 0x00, 0x00}, "UTF-32LE"},
+	{[]byte{0x00, 0x3C, 0x00, 0x3F}, "UTF-16BE"},
+	{[]byte{0x3C, 0x00, 0x3F, 0x00}, "UTF-16LE"},
+}
+
+// CharsetFromXml 解析 XML 声明中的 encoding
+func CharsetFromXml(body []byte) string {
+	var charset string
+
+	matches := regexCharsetXmlPattern.FindSubmatch(charsetDocHead(body))
+	if len(matches) > 1 {
+		charset = string(matches[1])
+	}
+
+	return convertCharset(charset)
+}
+
+// CharsetFromCss 解析 CSS 开头的 @charset 规则
+func CharsetFromCss(body []byte) string {
+	var charset string
+
+	matches := regexCharsetCssPattern.FindSubmatch(charsetDocHead(body))
+	if len(matches) > 1 {
+		charset = string(matches[1])
+	}
+
+	return convertCharset(charset)
+}
+
+// CharsetFromJson 根据 JSON 开头两个字符的 NULL 字节识别 UTF-16LE/BE、UTF-32LE/BE, 参考 RFC 4627
+// 不是 UTF-16/32 时返回空字符串
+func CharsetFromJson(body []byte) string {
+	if len(body) >= 4 {
+		switch {
+		case body[0] == 0 && body[1] == 0 && body[2] == 0 && body[3] != 0:
+			return "UTF-32BE"
+		case body[0] != 0 && body[1] == 0 && body[2] == 0 && body[3] == 0:
+			return "UTF-32LE"
+		case body[0] == 0 && body[1] != 0 && body[2] == 0 && body[3] != 0:
+			return "UTF-16BE"
+		case body[0] != 0 && body[1] == 0 && body[2] != 0 && body[3] == 0:
+			return "UTF-16LE"
+		}
+		return ""
+	}
+
+	// 只有一个字符
+	if len(body) == 2 {
+		switch {
+		case body[0] == 0 && body[1] != 0:
+			return "UTF-16BE"
+		case body[0] != 0 && body[1] == 0:
+			return "UTF-16LE"
+		}
+	}
+
+	return ""
+}
+
+// charsetFromXmlPrefix 没有 BOM 时根据 XML 声明的字节识别 UTF-16/32
+func charsetFromXmlPrefix(body []byte) string {
+	for _, b := range charsetXmlPrefixes {
+		if bytes.HasPrefix(body, b.prefix) {
+			return b.charset
+		}
+	}
+
+	return ""
+}
+
+// charsetFromUnicode 识别没有 BOM 的 UTF-16/32 JSON、XML, 这类 body 可能是有效的 UTF-8, 需要在检测 UTF-8 之前识别
+func charsetFromUnicode(body []byte, headers *http.Header) (string, string) {
+	if charsetJsonType(body, headers) {
+		if charset := CharsetFromJson(body); charset != "" {
+			return charset, CharsetPosJson
+		}
+	}
+
+	if charset := charsetFromXmlPrefix(body); charset != "" {
+		return charset, CharsetPosXml
+	}
+
+	return "", ""
+}
+
+// charsetFromDoc 解析文档中声明的 charset, 依次为 HTML meta、XML 声明、CSS @charset
+// 响应头为 XML 类型时优先使用 XML 声明
+func charsetFromDoc(body []byte, headers *http.Header) (string, string) {
+	charset, pos := charsetFromDocDeclared(body, headers)
+
+	// 能够解析出 ASCII 声明说明不是 UTF-16/32, 与 HTML 规范一致按 UTF-8 处理
+	if strings.HasPrefix(charset, "UTF-16") || strings.HasPrefix(charset, "UTF-32") {
+		charset = "UTF-8"
+	}
+
+	return charset, pos
+}
+
+func charsetFromDocDeclared(body []byte, headers *http.Header) (string, string) {
+	cXml := CharsetFromXml(body)
+	if cXml != "" && strings.HasSuffix(charsetMediaType(headers), "xml") {
+		return cXml, CharsetPosXml
+	}
+
+	if cHtml := CharsetFromHtml(body); cHtml != "" {
+		return cHtml, CharsetPosHtml
+	}
+
+	if cXml != "" {
+		return cXml, CharsetPosXml
+	}
+
+	if cCss := CharsetFromCss(body); cCss != "" {
+		return cCss, CharsetPosCss
+	}
+
+	return "", ""
+}
+
+// charsetJsonType 响应头为 JSON 类型, 或者 body 以 { [ 开头
+func charsetJsonType(body []byte, headers *http.Header) bool {
+	mediaType := charsetMediaType(headers)
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return true
+	}
+
+	for i := 0; i < len(body) && i < 4; i++ {
+		if body[i] != 0 {
+			return body[i] == '{' || body[i] == '['
+		}
+	}
+
+	return false
+}
+
+// charsetMediaType 返回小写的 Content-Type 媒体类型
+func charsetMediaType(headers *http.Header) string {
+	if headers == nil {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(headers.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+// charsetDocHead 返回用于识别声明的 body 开头
+func charsetDocHead(body []byte) []byte {
+	if len(body) > charsetDocLength {
+		return body[:charsetDocLength]
+	}
+
+	return body
+}
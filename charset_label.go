@@ -0,0 +1,196 @@
+package spider
+
+import (
+	"strings"
+)
+
+// charsetLabels WHATWG Encoding Standard 的字符集标签, 规范名称 => 标签
+// 规范名称使用大写, 为兼容保留 GBK、Big5、SHIFT_JIS 的写法
+// replacement 编码(ISO-2022-KR、ISO-2022-CN、HZ-GB-2312)的标签保持原样
+// https://encoding.spec.whatwg.org/#names-and-labels
+var charsetLabels = map[string][]string{
+	"UTF-8": {
+		"unicode-1-1-utf-8", "unicode11utf8", "unicode20utf8", "utf-8", "utf8", "x-unicode20utf8",
+		// 非标准
+		"utf_8",
+	},
+	"IBM866": {
+		"866", "cp866", "csibm866", "ibm866",
+	},
+	"ISO-8859-2": {
+		"csisolatin2", "iso-8859-2", "iso-ir-101", "iso8859-2", "iso88592", "iso_8859-2", "iso_8859-2:1987", "l2", "latin2",
+	},
+	"ISO-8859-3": {
+		"csisolatin3", "iso-8859-3", "iso-ir-109", "iso8859-3", "iso88593", "iso_8859-3", "iso_8859-3:1988", "l3", "latin3",
+	},
+	"ISO-8859-4": {
+		"csisolatin4", "iso-8859-4", "iso-ir-110", "iso8859-4", "iso88594", "iso_8859-4", "iso_8859-4:1988", "l4", "latin4",
+	},
+	"ISO-8859-5": {
+		"csisolatincyrillic", "cyrillic", "iso-8859-5", "iso-ir-144", "iso8859-5", "iso88595", "iso_8859-5", "iso_8859-5:1988",
+	},
+	"ISO-8859-6": {
+		"arabic", "asmo-708", "csiso88596e", "csiso88596i", "csisolatinarabic", "ecma-114", "iso-8859-6", "iso-8859-6-e",
+		"iso-8859-6-i", "iso-ir-127", "iso8859-6", "iso88596", "iso_8859-6", "iso_8859-6:1987",
+	},
+	"ISO-8859-7": {
+		"csisolatingreek", "ecma-118", "elot_928", "greek", "greek8", "iso-8859-7", "iso-ir-126", "iso8859-7", "iso88597",
+		"iso_8859-7", "iso_8859-7:1987", "sun_eu_greek",
+	},
+	"ISO-8859-8": {
+		"csiso88598e", "csisolatinhebrew", "hebrew", "iso-8859-8", "iso-8859-8-e", "iso-ir-138", "iso8859-8", "iso88598",
+		"iso_8859-8", "iso_8859-8:1988", "visual",
+	},
+	"ISO-8859-8-I": {
+		"csiso88598i", "iso-8859-8-i", "logical",
+	},
+	"ISO-8859-10": {
+		"csisolatin6", "iso-8859-10", "iso-ir-157", "iso8859-10", "iso885910", "l6", "latin6",
+	},
+	"ISO-8859-13": {
+		"iso-8859-13", "iso8859-13", "iso885913",
+	},
+	"ISO-8859-14": {
+		"iso-8859-14", "iso8859-14", "iso885914",
+	},
+	"ISO-8859-15": {
+		"csisolatin9", "iso-8859-15", "iso8859-15", "iso885915", "iso_8859-15", "l9",
+	},
+	"ISO-8859-16": {
+		"iso-8859-16",
+	},
+	"KOI8-R": {
+		"cskoi8r", "koi", "koi8", "koi8-r", "koi8_r",
+	},
+	"KOI8-U": {
+		"koi8-ru", "koi8-u",
+	},
+	"MACINTOSH": {
+		"csmacintosh", "mac", "macintosh", "x-mac-roman",
+	},
+	"WINDOWS-874": {
+		"dos-874", "iso-8859-11", "iso8859-11", "iso885911", "tis-620", "windows-874",
+	},
+	"WINDOWS-1250": {
+		"cp1250", "windows-1250", "x-cp1250",
+	},
+	"WINDOWS-1251": {
+		"cp1251", "windows-1251", "x-cp1251",
+	},
+	"WINDOWS-1252": {
+		"ansi_x3.4-1968", "ascii", "cp1252", "cp819", "csisolatin1", "ibm819", "iso-8859-1", "iso-ir-100", "iso8859-1",
+		"iso88591", "iso_8859-1", "iso_8859-1:1987", "l1", "latin1", "us-ascii", "windows-1252", "x-cp1252",
+	},
+	"WINDOWS-1253": {
+		"cp1253", "windows-1253", "x-cp1253",
+	},
+	"WINDOWS-1254": {
+		"cp1254", "csisolatin5", "iso-8859-9", "iso-ir-148", "iso8859-9", "iso88599", "iso_8859-9", "iso_8859-9:1989",
+		"l5", "latin5", "windows-1254", "x-cp1254",
+	},
+	"WINDOWS-1255": {
+		"cp1255", "windows-1255", "x-cp1255",
+	},
+	"WINDOWS-1256": {
+		"cp1256", "windows-1256", "x-cp1256",
+	},
+	"WINDOWS-1257": {
+		"cp1257", "windows-1257", "x-cp1257",
+	},
+	"WINDOWS-1258": {
+		"cp1258", "windows-1258", "x-cp1258",
+	},
+	"X-MAC-CYRILLIC": {
+		"x-mac-cyrillic", "x-mac-ukrainian",
+	},
+	"GBK": {
+		"chinese", "csgb2312", "csiso58gb231280", "gb2312", "gb_2312", "gb_2312-80", "gbk", "iso-ir-58", "x-gbk",
+		// 非标准, chardet 将 GBK 页面识别为 GB-18030
+		"cp936", "ms936", "windows-936", "euc-cn", "gb-18030",
+	},
+	"GB18030": {
+		"gb18030",
+	},
+	"Big5": {
+		"big5", "big5-hkscs", "cn-big5", "csbig5", "x-x-big5",
+	},
+	"EUC-JP": {
+		"cseucpkdfmtjapanese", "euc-jp", "x-euc-jp",
+	},
+	"ISO-2022-JP": {
+		"csiso2022jp", "iso-2022-jp",
+	},
+	"SHIFT_JIS": {
+		"csshiftjis", "ms932", "ms_kanji", "shift-jis", "shift_jis", "sjis", "windows-31j", "x-sjis",
+		// 非标准
+		"cp932",
+	},
+	"EUC-KR": {
+		"cseuckr", "csksc56011987", "euc-kr", "iso-ir-149", "korean", "ks_c_5601-1987", "ks_c_5601-1989", "ksc5601",
+		"ksc_5601", "windows-949",
+		// 非标准
+		"cp949",
+	},
+	"UTF-16BE": {
+		"unicodefffe", "utf-16be",
+	},
+	"UTF-16LE": {
+		"csunicode", "iso-10646-ucs-2", "ucs-2", "unicode", "unicodefeff", "utf-16", "utf-16le",
+	},
+	"X-USER-DEFINED": {
+		"x-user-defined",
+	},
+	// 非标准, WHATWG 不支持 UTF-32
+	"UTF-32BE": {
+		"utf-32be",
+	},
+	"UTF-32LE": {
+		"utf-32", "utf-32le",
+	},
+}
+
+// charsetLabelIndex 字符集标签 => 规范名称
+var charsetLabelIndex = func() map[string]string {
+	index := make(map[string]string)
+	for name, labels := range charsetLabels {
+		for _, label := range labels {
+			index[label] = name
+		}
+	}
+
+	return index
+}()
+
+// CharsetName 返回字符集标签对应的规范名称, 未知的标签返回大写形式
+func CharsetName(label string) string {
+	return convertCharset(label)
+}
+
+// convertCharset 格式化 charset, 按 WHATWG 标签表转换为规范名称
+func convertCharset(charset string) string {
+	label := strings.ToLower(strings.TrimSpace(charset))
+	if name, exist := charsetLabelIndex[label]; exist {
+		return name
+	}
+
+	c := strings.ToUpper(label)
+
+	if c != "" {
+		// alias gb2312-80..
+		if strings.HasPrefix(c, "GB") {
+			return "GBK"
+		}
+
+		// alias big5-hkscs..
+		if strings.HasPrefix(c, "BIG5") {
+			return "Big5"
+		}
+
+		// alias shift-jis
+		if strings.HasPrefix(c, "SHIFT") {
+			return "SHIFT_JIS"
+		}
+	}
+
+	return c
+}
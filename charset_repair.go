@@ -0,0 +1,273 @@
+package spider
+
+import (
+	"bytes"
+	"net/http"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+const (
+	// charsetRepairFallback 候选字符集都无法解码时使用的字符集, 单字节编码不会解码失败
+	charsetRepairFallback = "WINDOWS-1252"
+
+	// charsetRepairChunk 流式修复时单次处理的最大片段长度, 转换后不会超过 transform.Reader 的缓冲区
+	charsetRepairChunk = 1024
+)
+
+// charsetSegment 不是有效 UTF-8 的片段 [start, end)
+type charsetSegment struct {
+	start int
+	end   int
+}
+
+// charsetSegments 切分 body, 返回不是有效 UTF-8 的片段, 以及有效 UTF-8 的非 ASCII 字节数
+// 片段从包含无效字节的连续非 ASCII 字节开始, 按双字节编码向后扫描, Big5、SHIFT_JIS 等编码 ASCII 范围的尾字节不会被截断
+func charsetSegments(body []byte) ([]charsetSegment, int) {
+	var segments []charsetSegment
+	var validBytes int
+
+	runStart := -1
+	for i := 0; i < len(body); {
+		if body[i] < utf8.RuneSelf {
+			runStart = -1
+			i++
+			continue
+		}
+		if runStart < 0 {
+			runStart = i
+		}
+
+		if r, size := utf8.DecodeRune(body[i:]); r != utf8.RuneError || size > 1 {
+			validBytes += size
+			i += size
+			continue
+		}
+
+		// 连续非 ASCII 字节中已按 UTF-8 计数的部分, 可能是其他编码偶然构成的有效 UTF-8
+		validBytes -= i - runStart
+		end := charsetSegmentEnd(body, runStart)
+		segments = append(segments, charsetSegment{start: runStart, end: end})
+		runStart = -1
+		i = end
+	}
+
+	return segments, validBytes
+}
+
+// charsetSegmentEnd 从 start 按双字节编码扫描, 非 ASCII 首字节连同下一个字节一起跳过, 遇到 ASCII 首字节时结束
+func charsetSegmentEnd(body []byte, start int) int {
+	end := start
+	for end < len(body) && body[end] >= utf8.RuneSelf {
+		end += 2
+	}
+	if end > len(body) {
+		end = len(body)
+	}
+
+	return end
+}
+
+// charsetRepairRes 大部分非 ASCII 字节为有效的 UTF-8 时, 返回修复模式的 CharsetRes
+// 候选字符集依次为响应头或 HTML 声明的非 UTF-8 字符集、根据需要修复的片段猜测的字符集
+func charsetRepairRes(body []byte, headers *http.Header) (CharsetRes, bool) {
+	var res CharsetRes
+
+	segments, validBytes := charsetSegments(body)
+	var invalidBytes int
+	for _, s := range segments {
+		invalidBytes += s.end - s.start
+	}
+	if invalidBytes == 0 || validBytes <= invalidBytes {
+		return res, false
+	}
+
+	declared := CharsetFromHeaderHtml(body, headers)
+	res.HeaderCharset = declared.HeaderCharset
+	res.HtmlCharset = declared.HtmlCharset
+	res.XmlCharset = declared.XmlCharset
+	res.CssCharset = declared.CssCharset
+	res.Charset = "UTF-8"
+	res.CharsetPos = CharsetPosRepair
+	res.Confidence = validBytes * 100 / (validBytes + invalidBytes)
+	res.RepairedBytes = invalidBytes
+
+	// 使用空格连接需要修复的片段进行猜测
+	invalid := make([]byte, 0, invalidBytes+len(segments))
+	for _, s := range segments {
+		invalid = append(invalid, body[s.start:s.end]...)
+		invalid = append(invalid, ' ')
+	}
+	res.Candidates = charsetRepairCandidates(invalid, declared)
+
+	return res, true
+}
+
+// charsetRepairCandidates 修复使用的候选字符集, 声明的非 UTF-8 字符集在最前, 然后是根据 invalid 猜测的字符集
+func charsetRepairCandidates(invalid []byte, declared CharsetRes) []CharsetCandidate {
+	var candidates []CharsetCandidate
+	if declared.Charset != "" && declared.Charset != "UTF-8" {
+		candidates = append(candidates, CharsetCandidate{Charset: declared.Charset, Confidence: declared.Confidence, Replacements: -1})
+	}
+
+	for _, c := range CharsetCandidates(invalid) {
+		if c.Charset != "UTF-8" && c.Charset != declared.Charset {
+			candidates = append(candidates, c)
+		}
+	}
+
+	return candidates
+}
+
+// CharsetRepair 修复混合编码的 body, 有效的 UTF-8 保持不变, 其他片段使用替换字符最少的候选字符集转换为 UTF-8
+// 对前 CharsetTrialCount 个候选字符集试解码, 都无法解码时按 WINDOWS-1252 转换, 返回 UTF-8 body 和修复的字节数
+func CharsetRepair(body []byte, candidates []CharsetCandidate) ([]byte, int) {
+	segments, _ := charsetSegments(body)
+	if len(segments) == 0 {
+		return body, 0
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(body) * 2)
+	repaired := charsetRepairSegments(&buf, body, segments, charsetRepairCharsets(candidates))
+
+	return buf.Bytes(), repaired
+}
+
+// charsetRepairSegments 将修复后的 body 写入 buf, 返回修复的字节数
+func charsetRepairSegments(buf *bytes.Buffer, body []byte, segments []charsetSegment, charsets []string) int {
+	var repaired, last int
+	for _, s := range segments {
+		buf.Write(body[last:s.start])
+		buf.Write(charsetRepairSegment(body[s.start:s.end], charsets))
+		repaired += s.end - s.start
+		last = s.end
+	}
+	buf.Write(body[last:])
+
+	return repaired
+}
+
+// charsetRepairCharsets 返回试解码的字符集, 依次为前 CharsetTrialCount 个候选字符集和 charsetRepairFallback
+func charsetRepairCharsets(candidates []CharsetCandidate) []string {
+	var charsets []string
+	for _, c := range candidates {
+		if len(charsets) == CharsetTrialCount {
+			break
+		}
+		charsets = append(charsets, c.Charset)
+	}
+
+	return append(charsets, charsetRepairFallback)
+}
+
+// charsetRepairSegment 使用替换字符最少的字符集转换片段, 替换字符数量相同时优先使用靠前的字符集
+func charsetRepairSegment(segment []byte, charsets []string) []byte {
+	var best []byte
+	bestReplacements := -1
+
+	for _, charset := range charsets {
+		utf8Segment, err := charsetDecode(segment, charset)
+		if err != nil {
+			continue
+		}
+
+		replacements := bytes.Count(utf8Segment, []byte(string(utf8.RuneError)))
+		if bestReplacements == -1 || replacements < bestReplacements {
+			best = utf8Segment
+			bestReplacements = replacements
+		}
+		if replacements == 0 {
+			break
+		}
+	}
+
+	if best == nil {
+		return bytes.ToValidUTF8(segment, []byte(string(utf8.RuneError)))
+	}
+
+	return best
+}
+
+// charsetRepairTransformer 流式修复混合编码, 用于 HttpStream, 有效的 UTF-8 原样输出
+// 修复的字节数累加到 res.RepairedBytes, 并将 res.CharsetPos 设置为 CharsetPosRepair
+type charsetRepairTransformer struct {
+	transform.NopResetter
+	res      *CharsetRes
+	declared CharsetRes
+	charsets []string
+}
+
+// newCharsetRepairTransformer 创建 charsetRepairTransformer
+// res.Candidates 为空时, 在第一次需要修复时根据之后的数据猜测候选字符集
+func newCharsetRepairTransformer(res *CharsetRes, declared CharsetRes) *charsetRepairTransformer {
+	t := &charsetRepairTransformer{res: res, declared: declared}
+	if len(res.Candidates) > 0 {
+		t.charsets = charsetRepairCharsets(res.Candidates)
+	}
+
+	return t
+}
+
+func (t *charsetRepairTransformer) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	var nDst, nSrc int
+
+	for nSrc < len(src) {
+		// ASCII 原样输出
+		if src[nSrc] < utf8.RuneSelf {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = src[nSrc]
+			nDst++
+			nSrc++
+			continue
+		}
+
+		end := nSrc
+		for end < len(src) && src[end] >= utf8.RuneSelf && end-nSrc < charsetRepairChunk {
+			end += 2
+		}
+		if end > len(src) {
+			end = len(src)
+		}
+		segment := src[nSrc:end]
+
+		if end-nSrc >= charsetRepairChunk {
+			// 片段过长时分段处理, 避免截断 UTF-8 字符
+			if trimmed := trimIncompleteRune(segment); utf8.Valid(trimmed) && len(trimmed) > 0 {
+				segment = trimmed
+			}
+		} else if end == len(src) && !atEOF {
+			// 片段可能未结束, 等待更多数据
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+
+		out := segment
+		repaired := 0
+		if !utf8.Valid(segment) {
+			if t.charsets == nil {
+				t.res.Candidates = charsetRepairCandidates(src[nSrc:], t.declared)
+				t.charsets = charsetRepairCharsets(t.res.Candidates)
+			}
+
+			var buf bytes.Buffer
+			segments, _ := charsetSegments(segment)
+			repaired = charsetRepairSegments(&buf, segment, segments, t.charsets)
+			out = buf.Bytes()
+		}
+		if nDst+len(out) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], out)
+		nSrc += len(segment)
+
+		if repaired > 0 {
+			t.res.RepairedBytes += repaired
+			t.res.CharsetPos = CharsetPosRepair
+		}
+	}
+
+	return nDst, nSrc, nil
+}
@@ -1 +1,404 @@
 package spider
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/x-funs/go-fun"
+	"golang.org/x/text/transform"
+)
+
+func TestCharsetConfidence(t *testing.T) {
+	gbk, _ := fun.Utf8To([]byte(strings.Repeat("国务院办公厅印发关于进一步优化营商环境降低市场主体制度性交易成本的意见。", 20)), "gbk")
+	html := []byte(`<html><head><meta charset="gbk"></head><body>` + string(gbk) + `</body></html>`)
+
+	for _, c := range []struct {
+		body        []byte
+		contentType string
+		charset     string
+		pos         string
+		confidence  int
+	}{
+		{[]byte("<html>中国</html>"), "text/html", "UTF-8", CharsetPosValid, 100},
+		{html, "text/html; charset=gbk", "GBK", CharsetPosHeader, 100},
+		{html, "text/html", "GBK", CharsetPosHtml, 90},
+		{html, "text/html; charset=big5", "Big5", CharsetPosHeader, 70},
+	} {
+		headers := http.Header{"Content-Type": []string{c.contentType}}
+		res := Charset(c.body, &headers)
+		if res.Charset != c.charset || res.CharsetPos != c.pos || res.Confidence != c.confidence {
+			t.Errorf("%s want %s %s %d, got %+v", c.contentType, c.charset, c.pos, c.confidence, res)
+		}
+	}
+
+	headers := http.Header{"Content-Type": []string{"text/html; charset=big5"}}
+	res := Charset(html, &headers)
+	if res.HeaderCharset != "Big5" || res.HtmlCharset != "GBK" || res.Candidates != nil {
+		t.Errorf("unexpected declarations %+v", res)
+	}
+}
+
+func TestCharsetCandidates(t *testing.T) {
+	gbk, _ := fun.Utf8To([]byte(strings.Repeat("国务院办公厅印发关于进一步优化营商环境降低市场主体制度性交易成本的意见。", 20)), "gbk")
+	body := []byte("<html><body>" + string(gbk) + "</body></html>")
+
+	res := Charset(body, nil)
+	if res.Charset != "GBK" || res.CharsetPos != CharsetPosGuess || res.Confidence <= 0 {
+		t.Fatalf("want guess GBK, got %+v", res)
+	}
+
+	candidates := res.Candidates
+	if len(candidates) == 0 || candidates[0].Charset != "GBK" || candidates[0].Replacements != 0 {
+		t.Fatalf("unexpected candidates %+v", candidates)
+	}
+	for i := 1; i < len(candidates) && i < CharsetTrialCount; i++ {
+		if candidates[i].Replacements < candidates[i-1].Replacements {
+			t.Errorf("candidates not sorted by replacements %+v", candidates)
+		}
+	}
+	for i := CharsetTrialCount; i < len(candidates); i++ {
+		if candidates[i].Replacements != -1 {
+			t.Errorf("want no trial for candidate %+v", candidates[i])
+		}
+	}
+
+	// 截断时忽略末尾不完整的字符
+	if n := charsetReplacements(gbk[:len(gbk)-1], "GBK", true); n != 0 {
+		t.Errorf("want 0 replacements for truncated body, got %d", n)
+	}
+	if n := charsetReplacements(gbk, "UNKNOWN-CHARSET", false); n != len(gbk) {
+		t.Errorf("want %d replacements for unknown charset, got %d", len(gbk), n)
+	}
+}
+
+// testEncodeBody 按字符集编码的测试 body, 不带 BOM
+func testEncodeBody(t *testing.T, text string, charset string) []byte {
+	e, err := charsetEncoding(charset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := e.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body
+}
+
+// testBomBody 带 BOM 的测试 body
+func testBomBody(t *testing.T, html string, charset string) []byte {
+	body := testEncodeBody(t, html, charset)
+	for _, b := range charsetBoms {
+		if b.charset == charset {
+			return append(append([]byte{}, b.bom...), body...)
+		}
+	}
+
+	return body
+}
+
+func TestCharsetBom(t *testing.T) {
+	// 过时的 gbk 声明
+	html := `<html><head><meta charset="gbk"><title>示例新闻网</title></head><body>中国</body></html>`
+	headers := http.Header{"Content-Type": []string{"text/html; charset=gbk"}}
+
+	for _, charset := range []string{"UTF-8", "UTF-16LE", "UTF-16BE", "UTF-32LE", "UTF-32BE"} {
+		body := testBomBody(t, html, charset)
+
+		res := Charset(body, &headers)
+		if res.Charset != charset || res.CharsetPos != CharsetPosBom || res.Confidence != 100 {
+			t.Errorf("%s unexpected charset %+v", charset, res)
+		}
+
+		utf8Body, _, err := charsetToUtf8(body, &headers)
+		if err != nil || string(utf8Body) != html {
+			t.Errorf("%s unexpected body %q %v", charset, utf8Body, err)
+		}
+	}
+
+	if charset, n := CharsetFromBom([]byte("<html>")); charset != "" || n != 0 {
+		t.Errorf("want no bom, got %s %d", charset, n)
+	}
+}
+
+func TestHttpGetRespBom(t *testing.T) {
+	html := `<html><head><title>示例新闻网</title></head><body>中国</body></html>`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write(testBomBody(t, html, r.URL.Query().Get("charset")))
+	}))
+	defer ts.Close()
+
+	for _, charset := range []string{"UTF-8", "UTF-16LE", "UTF-32BE"} {
+		resp, err := HttpGetResp(ts.URL+"/?charset="+charset, nil, 5000)
+		if err != nil || string(resp.Body) != html || resp.Charset.CharsetPos != CharsetPosBom {
+			t.Errorf("%s unexpected body %q %+v %v", charset, resp.Body, resp.Charset, err)
+		}
+
+		stream, err := HttpGetStream(ts.URL+"/?charset="+charset, nil, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(stream)
+		_ = stream.Close()
+		if string(body) != html {
+			t.Errorf("%s unexpected stream body %q", charset, body)
+		}
+	}
+}
+
+func TestCharsetName(t *testing.T) {
+	for label, name := range map[string]string{
+		"x-gbk":           "GBK",
+		"cp936":           "GBK",
+		"GB2312":          "GBK",
+		"gb18030":         "GB18030",
+		"windows-31j":     "SHIFT_JIS",
+		"x-sjis":          "SHIFT_JIS",
+		"ks_c_5601-1987":  "EUC-KR",
+		"latin1":          "WINDOWS-1252",
+		"iso_8859-1:1987": "WINDOWS-1252",
+		"tis-620":         "WINDOWS-874",
+		"big5-hkscs":      "Big5",
+		" UTF8 ":          "UTF-8",
+		"utf-16":          "UTF-16LE",
+		"iso-2022-kr":     "ISO-2022-KR",
+		"":                "",
+	} {
+		if got := CharsetName(label); got != name {
+			t.Errorf("%q want %s, got %s", label, name, got)
+		}
+	}
+
+	// 规范名称均可解码
+	for name := range charsetLabels {
+		if _, err := charsetEncoding(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestCharsetLabel(t *testing.T) {
+	sjis, _ := fun.Utf8To([]byte("日本語のテキスト"), "shift_jis")
+	body := []byte(`<html><head><meta http-equiv="Content-Type" content="text/html; charset=x-sjis"></head><body>` + string(sjis) + `</body></html>`)
+
+	headers := http.Header{"Content-Type": []string{"text/html; charset=windows-31j"}}
+	res := Charset(body, &headers)
+	if res.Charset != "SHIFT_JIS" || res.CharsetPos != CharsetPosHeader || res.Confidence != 100 {
+		t.Fatalf("want header SHIFT_JIS, got %+v", res)
+	}
+
+	headers = http.Header{"Content-Type": []string{"text/html; charset=iso_8859-1:1987"}}
+	if c := CharsetFromHeader(&headers); c != "WINDOWS-1252" {
+		t.Errorf("want WINDOWS-1252, got %s", c)
+	}
+
+	if lang := Lang(nil, "windows-31j", false); lang.Lang != "ja" || lang.LangPos != LangPosCharset {
+		t.Errorf("want ja, got %+v", lang)
+	}
+
+	for label, want := range map[string]string{"greek": "el", "cp1253": "el", "visual": "he", "logical": "he"} {
+		if lang := Lang(nil, label, false); lang.Lang != want || lang.LangPos != LangPosCharset {
+			t.Errorf("%s want %s, got %+v", label, want, lang)
+		}
+	}
+
+	// 多个语种共用的字符集交给文本识别
+	for _, label := range []string{"windows-1256", "iso-8859-6", "ibm866", "windows-1255"} {
+		if lang, ok := CharsetLangMap[CharsetName(label)]; ok {
+			t.Errorf("%s want no charset lang, got %s", label, lang)
+		}
+	}
+}
+
+// testMixedFooters 混合在 UTF-8 页面中的其他编码页脚, Big5 的 "許"、SHIFT_JIS 的 "表" 尾字节在 ASCII 范围
+var testMixedFooters = map[string]string{
+	"GBK":       `<div class="footer">版权所有 中华人民共和国国务院新闻办公室 联系我们</div></body></html>`,
+	"Big5":      `<div class="footer">版權所有 聯絡我們 許可證編號 中華民國行政院新聞局</div></body></html>`,
+	"SHIFT_JIS": `<div class="footer">著作権表示 お問い合わせ 株式会社日本経済新聞社 無断転載を禁じます</div></body></html>`,
+}
+
+// testMixedBody UTF-8 正文重复 repeat 次, 页脚为 charset 编码的混合页面
+func testMixedBody(t *testing.T, repeat int, charset string) (string, []byte) {
+	main := `<html><head><meta charset="utf-8"><title>示例新闻网</title></head><body>` + strings.Repeat("<p>国务院办公厅印发关于进一步优化营商环境的意见。</p>", repeat)
+	footer := testMixedFooters[charset]
+	encoded, err := fun.Utf8To([]byte(footer), charset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return main + footer, append([]byte(main), encoded...)
+}
+
+func TestCharsetRepair(t *testing.T) {
+	for charset := range testMixedFooters {
+		html, body := testMixedBody(t, 20, charset)
+
+		headers := http.Header{"Content-Type": []string{"text/html"}}
+		res := Charset(body, &headers)
+		if res.Charset != "UTF-8" || res.CharsetPos != CharsetPosRepair || res.HtmlCharset != "UTF-8" {
+			t.Fatalf("%s want repair UTF-8, got %+v", charset, res)
+		}
+		if res.RepairedBytes == 0 || res.Confidence >= 100 || len(res.Candidates) == 0 || res.Candidates[0].Charset != charset {
+			t.Fatalf("%s unexpected repair result %+v", charset, res)
+		}
+
+		utf8Body, repaired := CharsetRepair(body, res.Candidates)
+		if string(utf8Body) != html || repaired != res.RepairedBytes {
+			t.Errorf("%s unexpected repaired body %d %q", charset, repaired, utf8Body[len(utf8Body)-200:])
+		}
+
+		// 流式修复, 逐字节读取, 未指定候选字符集时在读取时猜测
+		for _, candidates := range [][]CharsetCandidate{res.Candidates, nil} {
+			streamRes := CharsetRes{Candidates: candidates}
+			reader := iotest.OneByteReader(bytes.NewReader(body))
+			repairedBody, err := io.ReadAll(transform.NewReader(reader, newCharsetRepairTransformer(&streamRes, CharsetRes{})))
+			if err != nil || string(repairedBody) != html || streamRes.RepairedBytes == 0 || streamRes.CharsetPos != CharsetPosRepair {
+				t.Errorf("%s unexpected stream repair %+v %v", charset, streamRes, err)
+			}
+			if streamRes.Candidates[0].Charset != charset {
+				t.Errorf("%s want first stream candidate %s, got %+v", charset, charset, streamRes.Candidates)
+			}
+		}
+
+		// chardet 的结果顺序不稳定, 置信度和替换字符数量相同时候选字符集的顺序固定
+		encoded, _ := fun.Utf8To([]byte(testMixedFooters[charset]), charset)
+		segments, _ := charsetSegments(encoded)
+		segment := encoded[segments[0].start:segments[0].end]
+		want := CharsetCandidates(segment)
+		if want[0].Charset != charset {
+			t.Errorf("%s want first candidate %s, got %+v", charset, charset, want)
+		}
+		for i := 0; i < 20; i++ {
+			if got := CharsetCandidates(segment); !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s unstable candidates %+v, want %+v", charset, got, want)
+			}
+		}
+	}
+
+	// 超过 charsetRepairChunk 的片段
+	long := strings.Repeat("中国", charsetRepairChunk)
+	longBody, err := io.ReadAll(transform.NewReader(strings.NewReader(long), newCharsetRepairTransformer(&CharsetRes{}, CharsetRes{})))
+	if err != nil || string(longBody) != long {
+		t.Errorf("unexpected long stream repair %v", err)
+	}
+
+	// 声明的非 UTF-8 字符集优先
+	_, body := testMixedBody(t, 20, "GBK")
+	headers := http.Header{"Content-Type": []string{"text/html; charset=big5"}}
+	if res := Charset(body, &headers); res.CharsetPos != CharsetPosRepair || res.Candidates[0].Charset != "Big5" {
+		t.Errorf("want declared candidate first, got %+v", res)
+	}
+
+	// 大部分为其他编码时不修复
+	html, _ := testMixedBody(t, 20, "GBK")
+	gbk, _ := fun.Utf8To([]byte(html), "gbk")
+	if res := Charset(append([]byte("中国"), gbk...), nil); res.CharsetPos == CharsetPosRepair {
+		t.Errorf("want no repair for GBK body, got %+v", res)
+	}
+}
+
+func TestHttpGetRespRepair(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repeat := fun.ToInt(r.URL.Query().Get("repeat"))
+		_, body := testMixedBody(t, repeat, r.URL.Query().Get("charset"))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(body)
+	}))
+	defer ts.Close()
+
+	// 页脚在流式探测长度之内和之后
+	for _, repeat := range []int{20, 200} {
+		for charset := range testMixedFooters {
+			html, _ := testMixedBody(t, repeat, charset)
+			urlStr := ts.URL + "/?repeat=" + fun.ToString(repeat) + "&charset=" + charset
+
+			resp, err := HttpGetResp(urlStr, nil, 5000)
+			if err != nil || string(resp.Body) != html || resp.Charset.RepairedBytes == 0 {
+				t.Errorf("%s %d unexpected repair %+v %v", charset, repeat, resp.Charset, err)
+			}
+
+			stream, err := HttpGetStream(urlStr, nil, 5000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamBody, _ := io.ReadAll(stream)
+			_ = stream.Close()
+			if string(streamBody) != html || stream.Charset.CharsetPos != CharsetPosRepair || stream.Charset.RepairedBytes == 0 {
+				t.Errorf("%s %d unexpected stream repair %+v", charset, repeat, stream.Charset)
+			}
+		}
+	}
+}
+
+func TestCharsetXmlJsonCss(t *testing.T) {
+	rss := `<?xml version="1.0" encoding="gbk"?><rss><channel><title>示例新闻网</title></channel></rss>`
+	rss16 := `<?xml version="1.0" encoding="UTF-16"?><rss><channel><title>示例新闻网</title></channel></rss>`
+	json := `{"title":"news"}`
+	css := `@charset "gbk"; .title:after { content: "示例新闻网"; }`
+
+	for _, c := range []struct {
+		body        []byte
+		contentType string
+		charset     string
+		pos         string
+	}{
+		{testEncodeBody(t, rss, "GBK"), "application/rss+xml", "GBK", CharsetPosXml},
+		{testEncodeBody(t, rss, "GBK"), "text/html", "GBK", CharsetPosXml},
+		{testEncodeBody(t, rss16, "UTF-16LE"), "text/xml", "UTF-16LE", CharsetPosXml},
+		{testEncodeBody(t, rss16, "UTF-32BE"), "", "UTF-32BE", CharsetPosXml},
+		{testEncodeBody(t, json, "UTF-16BE"), "application/json", "UTF-16BE", CharsetPosJson},
+		{testEncodeBody(t, json, "UTF-32LE"), "", "UTF-32LE", CharsetPosJson},
+		{testEncodeBody(t, "[]", "UTF-16LE"), "application/json", "UTF-16LE", CharsetPosJson},
+		{testEncodeBody(t, css, "GBK"), "text/css", "GBK", CharsetPosCss},
+		{[]byte(json), "application/json", "UTF-8", CharsetPosValid},
+	} {
+		headers := http.Header{"Content-Type": []string{c.contentType}}
+		res := Charset(c.body, &headers)
+		if res.Charset != c.charset || res.CharsetPos != c.pos {
+			t.Errorf("%s want %s %s, got %+v", c.contentType, c.charset, c.pos, res)
+		}
+	}
+
+	// 响应头为 XML 类型时优先使用 XML 声明
+	xhtml := `<?xml version="1.0" encoding="gbk"?><html><head><meta charset="big5"></head><body>中国</body></html>`
+	headers := http.Header{"Content-Type": []string{"application/xhtml+xml"}}
+	res := Charset(testEncodeBody(t, xhtml, "GBK"), &headers)
+	if res.Charset != "GBK" || res.XmlCharset != "GBK" || res.HtmlCharset != "" {
+		t.Errorf("want xml declaration, got %+v", res)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			w.Header().Set("Content-Type", "text/xml")
+			_, _ = w.Write(testEncodeBody(t, rss16, "UTF-16LE"))
+		case "/api":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(testEncodeBody(t, json, "UTF-16BE"))
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = w.Write(testEncodeBody(t, css, "GBK"))
+		}
+	}))
+	defer ts.Close()
+
+	for path, body := range map[string]string{"/feed": rss16, "/api": json, "/style.css": css} {
+		resp, err := HttpGetResp(ts.URL+path, nil, 5000)
+		if err != nil || string(resp.Body) != body {
+			t.Errorf("%s unexpected body %q %+v %v", path, resp.Body, resp.Charset, err)
+		}
+	}
+
+	// CSS 不在文本类型中, ForceTextContentType 时不允许
+	if _, err := HttpGetResp(ts.URL+"/style.css", &HttpReq{ForceTextContentType: true}, 5000); !errors.Is(err, ErrContentType) {
+		t.Errorf("want ErrContentType for css, got %v", err)
+	}
+}
@@ -2,7 +2,7 @@ package spider
 
 import (
 	"bytes"
-	"errors"
+	"context"
 	"net/url"
 	"strings"
 
@@ -46,6 +46,12 @@ type DomainRes struct {
 	ListCount int
 	// 子域名列表
 	SubDomains map[string]bool
+	// Feed 链接列表
+	Feeds []string
+	// HTTP 跳转链
+	Redirects []HttpRedirect
+	// 请求耗时和网络信息, 仅设置 HttpReq.Trace 时记录
+	Trace *HttpTrace
 }
 
 // DetectDomain 域名探测
@@ -53,24 +59,22 @@ type DomainRes struct {
 // DomainRes.State true 可能会返回 err, 如 doc 解析失败
 // DomainRes.State false 时根据 StatusCode 判断是请求是否成功或请求成功但响应失败(如404)
 func DetectDomain(domain string, timeout int, retry int) (*DomainRes, error) {
-	if retry == 0 {
-		retry = 1
-	}
+	return DetectDomainCtx(context.Background(), domain, timeout, retry)
+}
 
-	for i := 0; i < retry; i++ {
-		domainRes, err := DetectDomainDo(domain, true, timeout)
-		if domainRes.StatusCode != 0 || err == nil {
-			return domainRes, err
-		}
-	}
+// DetectDomainCtx 域名探测, 支持 context 取消
+func DetectDomainCtx(ctx context.Context, domain string, timeout int, retry int) (*DomainRes, error) {
+	return DetectDomainWithReqCtx(ctx, domain, nil, timeout, retry)
+}
 
-	var charset CharsetRes
-	var lang LangRes
-	domainRes := &DomainRes{
-		Charset: charset,
-		Lang:    lang,
-	}
-	return domainRes, errors.New("ErrorDomainDetect")
+// DetectDomainWithReq 域名探测, 可指定 HttpReq (如 Fetcher)
+func DetectDomainWithReq(domain string, req *HttpReq, timeout int, retry int) (*DomainRes, error) {
+	return DetectDomainWithReqCtx(context.Background(), domain, req, timeout, retry)
+}
+
+// DetectDomainWithReqCtx 域名探测, 可指定 HttpReq (如 Fetcher), 支持 context 取消
+func DetectDomainWithReqCtx(ctx context.Context, domain string, req *HttpReq, timeout int, retry int) (*DomainRes, error) {
+	return detectDomainRetry(ctx, domain, true, req, timeout, retry)
 }
 
 // DetectSubDomain 子域名探测
@@ -78,39 +82,73 @@ func DetectDomain(domain string, timeout int, retry int) (*DomainRes, error) {
 // DomainRes.State true 可能会返回 err, 如 doc 解析失败
 // DomainRes.State false 时根据 StatusCode 判断是请求是否成功或请求成功但响应失败(如404)
 func DetectSubDomain(domain string, timeout int, retry int) (*DomainRes, error) {
-	if retry == 0 {
-		retry = 1
-	}
+	return DetectSubDomainCtx(context.Background(), domain, timeout, retry)
+}
 
-	for i := 0; i < retry; i++ {
-		domainRes, err := DetectDomainDo(domain, false, timeout)
-		if domainRes.StatusCode != 0 || err == nil {
-			return domainRes, err
+// DetectSubDomainCtx 子域名探测, 支持 context 取消
+func DetectSubDomainCtx(ctx context.Context, domain string, timeout int, retry int) (*DomainRes, error) {
+	return DetectSubDomainWithReqCtx(ctx, domain, nil, timeout, retry)
+}
+
+// DetectSubDomainWithReq 子域名探测, 可指定 HttpReq (如 Fetcher)
+func DetectSubDomainWithReq(domain string, req *HttpReq, timeout int, retry int) (*DomainRes, error) {
+	return DetectSubDomainWithReqCtx(context.Background(), domain, req, timeout, retry)
+}
+
+// DetectSubDomainWithReqCtx 子域名探测, 可指定 HttpReq (如 Fetcher), 支持 context 取消
+func DetectSubDomainWithReqCtx(ctx context.Context, domain string, req *HttpReq, timeout int, retry int) (*DomainRes, error) {
+	return detectDomainRetry(ctx, domain, false, req, timeout, retry)
+}
+
+// detectDomainRetry 按重试策略进行域名探测, 仅在请求未得到响应(StatusCode 为 0)时重试
+func detectDomainRetry(ctx context.Context, domain string, isTop bool, req *HttpReq, timeout int, retry int) (*DomainRes, error) {
+	var domainRes *DomainRes
+	var domainErr error
+
+	err := retryDo(ctx, retryPolicy(req, retry), ErrDomainDetect, func() error {
+		domainRes, domainErr = detectDomainDo(ctx, domain, isTop, req, timeout)
+		if domainRes.StatusCode != 0 || domainErr == nil {
+			return nil
 		}
+		return domainErr
+	})
+	if err == nil {
+		return domainRes, domainErr
 	}
 
 	var charset CharsetRes
 	var lang LangRes
-	domainRes := &DomainRes{
+	domainRes = &DomainRes{
 		Charset: charset,
 		Lang:    lang,
 	}
-	return domainRes, errors.New("ErrorDomainDetect")
+	return domainRes, err
 }
 
 func DetectDomainDo(domain string, isTop bool, timeout int) (*DomainRes, error) {
+	return DetectDomainDoCtx(context.Background(), domain, isTop, timeout)
+}
+
+// DetectDomainDoCtx 域名探测, 支持 context 取消
+func DetectDomainDoCtx(ctx context.Context, domain string, isTop bool, timeout int) (*DomainRes, error) {
+	return detectDomainDo(ctx, domain, isTop, nil, timeout)
+}
+
+func detectDomainDo(ctx context.Context, domain string, isTop bool, req *HttpReq, timeout int) (*DomainRes, error) {
 	if timeout == 0 {
 		timeout = 10000
 	}
 
 	domainRes := &DomainRes{}
 
-	req := &HttpReq{
-		HttpReq: &fun.HttpReq{
-			MaxContentLength: 10 * 1024 * 1024,
-			MaxRedirect:      3,
-		},
-		ForceTextContentType: true,
+	if req == nil {
+		req = &HttpReq{
+			HttpReq: &fun.HttpReq{
+				MaxContentLength: 10 * 1024 * 1024,
+				MaxRedirect:      3,
+			},
+			ForceTextContentType: true,
+		}
 	}
 
 	scheme := "http"
@@ -123,6 +161,8 @@ func DetectDomainDo(domain string, isTop bool, timeout int) (*DomainRes, error)
 		homes = []string{""}
 	}
 
+	var lastErr error
+
 	for _, home := range homes {
 
 		var urlStr string
@@ -135,7 +175,14 @@ func DetectDomainDo(domain string, isTop bool, timeout int) (*DomainRes, error)
 			urlStr = scheme + "://" + homeDomain
 		}
 
-		resp, err := HttpGetResp(urlStr, req, timeout)
+		resp, err := req.fetcher().Fetch(ctx, urlStr, req, timeout)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return domainRes, ctxErr
+		}
+		if resp != nil {
+			domainRes.Redirects = resp.Redirects
+			domainRes.Trace = resp.Trace
+		}
 
 		if resp != nil && err == nil && resp.Success {
 			domainRes.Domain = domain
@@ -149,14 +196,14 @@ func DetectDomainDo(domain string, isTop bool, timeout int) (*DomainRes, error)
 				if requestTopDomain != "" && requestTopDomain != domain {
 					// 验证主机名
 					if RegexHostnameIpPattern.MatchString(requestHostname) {
-						return domainRes, errors.New("ErrorRedirectHost")
+						return domainRes, ErrRedirectHost
 					}
 					// 验证非常规端口
 					if resp.RequestURL.Port() != "" {
-						return domainRes, errors.New("ErrorRedirectHost")
+						return domainRes, ErrRedirectHost
 					}
 
-					return domainRes, errors.New("ErrorRedirect:" + requestTopDomain)
+					return domainRes, &RedirectError{Domain: requestTopDomain}
 				}
 
 				domainRes.HomeDomain = requestHostname
@@ -175,6 +222,9 @@ func DetectDomainDo(domain string, isTop bool, timeout int) (*DomainRes, error)
 			u, _ := url.Parse(urlStr)
 			doc, docErr := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
 			if docErr == nil {
+				// Feed, 需要在移除 link 标签之前获取
+				domainRes.Feeds = extract.WebFeeds(doc, resp.RequestURL)
+
 				doc.Find(DefaultDocRemoveTags).Remove()
 
 				// 具有 HTML 跳转属性, HTTP 无法自动处理永远返回错误, 判断跳转后是否是同一个主域名, 记录并返回
@@ -188,17 +238,17 @@ func DetectDomainDo(domain string, isTop bool, timeout int) (*DomainRes, error)
 							if refreshTopDomain != "" && refreshTopDomain != domain {
 								// 验证主机名
 								if RegexHostnameIpPattern.MatchString(refreshHostname) {
-									return domainRes, errors.New("ErrorMetaJumpHost")
+									return domainRes, ErrMetaJumpHost
 								}
 								// 验证非常规端口
 								if r.Port() != "" {
-									return domainRes, errors.New("ErrorMetaJumpHost")
+									return domainRes, ErrMetaJumpHost
 								}
 
-								return domainRes, errors.New("ErrorMetaJump:" + refreshTopDomain)
+								return domainRes, &RedirectError{Domain: refreshTopDomain, Meta: true}
 							}
 						}
-						return domainRes, errors.New("ErrorMetaJump")
+						return domainRes, ErrMetaJump
 					}
 				}
 
@@ -241,48 +291,73 @@ func DetectDomainDo(domain string, isTop bool, timeout int) (*DomainRes, error)
 
 				return domainRes, nil
 			} else {
-				return domainRes, errors.New("ErrorDocParse")
+				return domainRes, ErrDocParse
 			}
 		} else {
-			if resp != nil {
+			if resp != nil && resp.HttpResp != nil {
 				domainRes.StatusCode = resp.StatusCode
 			}
+			lastErr = fetchError(resp, err)
 		}
 	}
 
-	return domainRes, errors.New("ErrorDomainDetect")
+	return domainRes, withCause(ErrDomainDetect, lastErr)
 }
 
 func DetectFriendDomain(domain string, timeout int, retry int) (map[string]string, error) {
-	if retry == 0 {
-		retry = 1
-	}
+	return DetectFriendDomainCtx(context.Background(), domain, timeout, retry)
+}
 
-	friendDomains := make(map[string]string, 0)
+// DetectFriendDomainCtx 友链域名探测, 支持 context 取消
+func DetectFriendDomainCtx(ctx context.Context, domain string, timeout int, retry int) (map[string]string, error) {
+	return DetectFriendDomainWithReqCtx(ctx, domain, nil, timeout, retry)
+}
 
-	for i := 0; i < retry; i++ {
-		friendDomains, err := DetectFriendDomainDo(domain, timeout)
-		if err == nil {
-			return friendDomains, err
-		}
+// DetectFriendDomainWithReq 友链域名探测, 可指定 HttpReq (如 Fetcher)
+func DetectFriendDomainWithReq(domain string, req *HttpReq, timeout int, retry int) (map[string]string, error) {
+	return DetectFriendDomainWithReqCtx(context.Background(), domain, req, timeout, retry)
+}
+
+// DetectFriendDomainWithReqCtx 友链域名探测, 可指定 HttpReq (如 Fetcher), 支持 context 取消
+func DetectFriendDomainWithReqCtx(ctx context.Context, domain string, req *HttpReq, timeout int, retry int) (map[string]string, error) {
+	var friendDomains map[string]string
+
+	err := retryDo(ctx, retryPolicy(req, retry), ErrDomainDetect, func() error {
+		var err error
+		friendDomains, err = detectFriendDomainDo(ctx, domain, req, timeout)
+		return err
+	})
+	if err != nil {
+		return make(map[string]string, 0), err
 	}
 
-	return friendDomains, errors.New("ErrorDomainDetect")
+	return friendDomains, nil
 }
 
 func DetectFriendDomainDo(domain string, timeout int) (map[string]string, error) {
+	return DetectFriendDomainDoCtx(context.Background(), domain, timeout)
+}
+
+// DetectFriendDomainDoCtx 友链域名探测, 支持 context 取消
+func DetectFriendDomainDoCtx(ctx context.Context, domain string, timeout int) (map[string]string, error) {
+	return detectFriendDomainDo(ctx, domain, nil, timeout)
+}
+
+func detectFriendDomainDo(ctx context.Context, domain string, req *HttpReq, timeout int) (map[string]string, error) {
 	if timeout == 0 {
 		timeout = 10000
 	}
 
 	friendDomains := make(map[string]string, 0)
 
-	req := &HttpReq{
-		HttpReq: &fun.HttpReq{
-			MaxContentLength: 10 * 1024 * 1024,
-			MaxRedirect:      3,
-		},
-		ForceTextContentType: true,
+	if req == nil {
+		req = &HttpReq{
+			HttpReq: &fun.HttpReq{
+				MaxContentLength: 10 * 1024 * 1024,
+				MaxRedirect:      3,
+			},
+			ForceTextContentType: true,
+		}
 	}
 
 	scheme := "http"
@@ -300,7 +375,10 @@ func DetectFriendDomainDo(domain string, timeout int) (map[string]string, error)
 			urlStr = scheme + "://" + homeDomain
 		}
 
-		resp, err := HttpGetResp(urlStr, req, timeout)
+		resp, err := req.fetcher().Fetch(ctx, urlStr, req, timeout)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return friendDomains, ctxErr
+		}
 
 		if resp != nil && err == nil && resp.Success {
 
@@ -346,12 +424,12 @@ func DetectFriendDomainDo(domain string, timeout int) (map[string]string, error)
 
 				return friendDomains, nil
 			} else {
-				return friendDomains, errors.New("ErrorDocParse")
+				return friendDomains, ErrDocParse
 			}
 		} else {
-			return friendDomains, err
+			return friendDomains, fetchError(resp, err)
 		}
 	}
 
-	return friendDomains, errors.New("ErrorDomainDetect")
+	return friendDomains, ErrDomainDetect
 }
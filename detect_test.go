@@ -11,6 +11,8 @@ import (
 )
 
 func TestDomainDetect(t *testing.T) {
+	skipOnline(t)
+
 	domains := []string{
 		// "china-nengyuan.com",
 		// "suosi.com.cn",
@@ -32,6 +34,8 @@ func TestDomainDetect(t *testing.T) {
 }
 
 func BenchmarkLinkTitles(b *testing.B) {
+	skipOnline(b)
+
 	urlStr := "http://www.qq.com/"
 
 	resp, _ := HttpGetResp(urlStr, nil, 30000)
@@ -73,6 +77,8 @@ func BenchmarkLinkTitles(b *testing.B) {
 }
 
 func TestLinkTitles(t *testing.T) {
+	skipOnline(t)
+
 	var urlStrs = []string{
 		"https://www.1905.com",
 		// "https://www.people.com.cn",
@@ -171,6 +177,8 @@ func TestLinkTitles(t *testing.T) {
 }
 
 func TestDetectIcp(t *testing.T) {
+	skipOnline(t)
+
 	var urlStrs = []string{
 		// "http://suosi.com.cn",
 		"https://www.163.com",
@@ -196,6 +204,8 @@ func TestDetectIcp(t *testing.T) {
 }
 
 func TestLangFromUtf8Body(t *testing.T) {
+	skipOnline(t)
+
 	var urlStrs = []string{
 		// "https://www.163.com",
 		// "https://english.news.cn",
@@ -230,6 +240,8 @@ func TestLangFromUtf8Body(t *testing.T) {
 }
 
 func TestDetectFriendDomainDo(t *testing.T) {
+	skipOnline(t)
+
 	var domains = []string{
 		"northnews.cn",
 	}
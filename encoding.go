@@ -0,0 +1,112 @@
+package spider
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// gzip 魔数
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+	// zstd 魔数
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decodeReader 按 Content-Encoding 返回解压后的 io.ReadCloser, 未压缩或不支持的格式原样返回
+func decodeReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return flate.NewReader(r), nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+
+	return io.NopCloser(r), nil
+}
+
+// sniffEncoding 根据魔数识别未声明 Content-Encoding 的压缩响应, brotli 没有魔数无法识别
+// 仅对文本类型或未声明类型的响应识别, 避免解压 .gz 等文件下载
+func sniffEncoding(head []byte, headers http.Header) string {
+	ct := strings.TrimSpace(strings.ToLower(headers.Get("Content-Type")))
+	if ct != "" && !textContentType(ct) {
+		return ""
+	}
+
+	if bytes.HasPrefix(head, gzipMagic) {
+		return "gzip"
+	}
+	if bytes.HasPrefix(head, zstdMagic) {
+		return "zstd"
+	}
+
+	return ""
+}
+
+// textContentType 是否是文本类型
+func textContentType(ct string) bool {
+	for _, t := range textContentTypes {
+		if strings.HasPrefix(ct, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// httpRespDecode 解压 httpDo 未处理的 br、zstd 响应, 以及根据魔数识别出的压缩响应
+// 解压后移除 Content-Encoding、Content-Length 响应头, maxLength 为解压后的最大长度
+func httpRespDecode(httpResp *HttpResp, maxLength int64) error {
+	if httpResp.Headers == nil || len(httpResp.Body) == 0 {
+		return nil
+	}
+
+	headers := *httpResp.Headers
+	encoding := strings.ToLower(strings.TrimSpace(headers.Get("Content-Encoding")))
+	if encoding != "br" && encoding != "zstd" {
+		// gzip、deflate 已由 httpDo 解压
+		encoding = sniffEncoding(httpResp.Body, headers)
+	}
+	if encoding == "" {
+		return nil
+	}
+
+	reader, err := decodeReader(encoding, bytes.NewReader(httpResp.Body))
+	if err != nil {
+		return withCause(ErrGzip, err)
+	}
+	defer reader.Close()
+
+	if maxLength <= 0 {
+		maxLength = HttpDefaultMaxContentLength
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, maxLength+1))
+	if err != nil {
+		return withCause(ErrGzip, err)
+	}
+	if int64(len(body)) > maxLength {
+		return ErrContentLength
+	}
+
+	headers.Del("Content-Encoding")
+	headers.Del("Content-Length")
+	httpResp.Body = body
+	httpResp.ContentLength = int64(len(body))
+
+	return nil
+}
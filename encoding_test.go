@@ -0,0 +1,92 @@
+package spider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/x-funs/go-fun"
+)
+
+func TestHttpGetRespContentEncoding(t *testing.T) {
+	html := "<html><head><meta charset=\"gbk\"></head><body>中国</body></html>"
+	gbk, _ := fun.Utf8To([]byte(html), "gbk")
+
+	var buf bytes.Buffer
+	bw := brotli.NewWriter(&buf)
+	_, _ = bw.Write(gbk)
+	_ = bw.Close()
+	brBody := append([]byte(nil), buf.Bytes()...)
+
+	zw, _ := zstd.NewWriter(nil)
+	zstdBody := zw.EncodeAll(gbk, nil)
+	_ = zw.Close()
+
+	buf.Reset()
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write(gbk)
+	_ = gw.Close()
+	gzipBody := append([]byte(nil), buf.Bytes()...)
+
+	var acceptEncoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/br":
+			w.Header().Set("Content-Encoding", "br")
+			_, _ = w.Write(brBody)
+		case "/zstd":
+			w.Header().Set("Content-Encoding", "zstd")
+			_, _ = w.Write(zstdBody)
+		case "/gzip-unlabeled":
+			// 未声明 Content-Encoding 的 gzip 响应
+			_, _ = w.Write(gzipBody)
+		case "/zstd-unlabeled":
+			_, _ = w.Write(zstdBody)
+		case "/gzip-file":
+			w.Header().Set("Content-Type", "application/gzip")
+			_, _ = w.Write(gzipBody)
+		}
+	}))
+	defer ts.Close()
+
+	for _, path := range []string{"/br", "/zstd", "/gzip-unlabeled", "/zstd-unlabeled"} {
+		resp, err := HttpGetResp(ts.URL+path, nil, 5000)
+		if err != nil {
+			t.Fatalf("%s %v", path, err)
+		}
+		if string(resp.Body) != html || resp.Charset.Charset != "GBK" || resp.Headers.Get("Content-Encoding") != "" {
+			t.Errorf("%s unexpected body %q charset %+v", path, resp.Body, resp.Charset)
+		}
+
+		stream, err := HttpGetStream(ts.URL+path, nil, 5000)
+		if err != nil {
+			t.Fatalf("%s stream %v", path, err)
+		}
+		body, _ := io.ReadAll(stream)
+		_ = stream.Close()
+		if string(body) != html {
+			t.Errorf("%s unexpected stream body %q", path, body)
+		}
+	}
+	if acceptEncoding != HttpDefaultAcceptEncoding {
+		t.Errorf("want Accept-Encoding %s, got %s", HttpDefaultAcceptEncoding, acceptEncoding)
+	}
+
+	// 非文本类型不根据魔数解压
+	resp, err := HttpGetResp(ts.URL+"/gzip-file", &HttpReq{DisableCharset: true}, 5000)
+	if err != nil || !bytes.Equal(resp.Body, gzipBody) {
+		t.Errorf("want raw gzip file, got %v", err)
+	}
+
+	// 自定义 Accept-Encoding
+	if _, err := HttpGetResp(ts.URL+"/br", &HttpReq{HttpReq: &fun.HttpReq{Headers: map[string]string{"Accept-Encoding": "br"}}}, 5000); err != nil || acceptEncoding != "br" {
+		t.Errorf("want Accept-Encoding br, got %s %v", acceptEncoding, err)
+	}
+}
@@ -0,0 +1,206 @@
+package spider
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/x-funs/go-fun"
+)
+
+// 错误定义, 错误信息与历史版本保持一致, 可通过 errors.Is 判断
+var (
+	// ErrRequest 请求失败
+	ErrRequest = errors.New("ErrorRequest")
+	// ErrDocParse HTML 解析失败
+	ErrDocParse = errors.New("ErrorDocParse")
+	// ErrCharset 字符集转换失败
+	ErrCharset = errors.New("ErrorCharset")
+	// ErrLinkRes 获取页面链接数据失败
+	ErrLinkRes = errors.New("ErrorLinkRes")
+	// ErrDomainDetect 域名探测失败
+	ErrDomainDetect = errors.New("ErrorDomainDetect")
+	// ErrRedirect HTTP 跳转到其他域名
+	ErrRedirect = errors.New("ErrorRedirect")
+	// ErrRedirectHost HTTP 跳转到 IP 或非常规端口
+	ErrRedirectHost = errors.New("ErrorRedirectHost")
+	// ErrMetaJump HTML meta 跳转
+	ErrMetaJump = errors.New("ErrorMetaJump")
+	// ErrMetaJumpHost HTML meta 跳转到 IP 或非常规端口
+	ErrMetaJumpHost = errors.New("ErrorMetaJumpHost")
+	// ErrHttpParams Http 请求参数错误
+	ErrHttpParams = errors.New("http get params error")
+
+	// ErrDo 请求发送失败, 如 DNS、连接、超时等
+	ErrDo = errors.New("ErrorDo")
+	// ErrStatusCode 响应状态码非 2xx, 具体状态码见 StatusError
+	ErrStatusCode = errors.New("ErrorStatusCode")
+	// ErrContentType 响应 Content-Type 不在允许列表中
+	ErrContentType = errors.New("ErrorContentType")
+	// ErrContentLength 响应超过最大长度
+	ErrContentLength = errors.New("ErrorContentLength")
+	// ErrReadBody 读取响应失败
+	ErrReadBody = errors.New("ErrorReadBody")
+	// ErrGzip 响应解压失败
+	ErrGzip = errors.New("ErrorGzip")
+	// ErrProxy 代理地址错误或没有可用的代理
+	ErrProxy = errors.New("ErrorProxy")
+	// ErrTLSVerify TLS 证书校验失败
+	ErrTLSVerify = errors.New("ErrorTLSVerify")
+	// ErrRequestVetoed 请求被中间件拒绝
+	ErrRequestVetoed = errors.New("ErrorRequestVetoed")
+)
+
+// httpErrors 错误信息与错误的对照表, 错误信息与 fun.HttpDoResp 一致
+var httpErrors = map[string]error{
+	ErrDo.Error():            ErrDo,
+	ErrContentType.Error():   ErrContentType,
+	ErrContentLength.Error(): ErrContentLength,
+	ErrReadBody.Error():      ErrReadBody,
+	ErrGzip.Error():          ErrGzip,
+}
+
+// StatusError Http 状态码错误, errors.Is(err, ErrStatusCode) 为 true
+type StatusError struct {
+	// Http 状态码
+	StatusCode int
+	// Retry-After 响应头指定的等待时间
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return ErrStatusCode.Error() + ":" + strconv.Itoa(e.StatusCode)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrStatusCode
+}
+
+// RedirectError 跳转到其他域名的错误, 包括 HTTP 跳转和 HTML meta 跳转
+// errors.Is(err, ErrRedirect) 或 errors.Is(err, ErrMetaJump) 为 true
+type RedirectError struct {
+	// 跳转后的主域名
+	Domain string
+	// 是否是 HTML meta 跳转
+	Meta bool
+}
+
+func (e *RedirectError) Error() string {
+	if e.Meta {
+		return ErrMetaJump.Error() + ":" + e.Domain
+	}
+
+	return ErrRedirect.Error() + ":" + e.Domain
+}
+
+func (e *RedirectError) Is(target error) bool {
+	if e.Meta {
+		return target == ErrMetaJump
+	}
+
+	return target == ErrRedirect
+}
+
+// RetryError 重试耗尽的错误, 包含每次尝试的错误
+// errors.Is、errors.As 会依次匹配 Err 和每次尝试的错误
+type RetryError struct {
+	// 错误类型, 如 ErrLinkRes、ErrRequest、ErrDomainDetect
+	Err error
+	// 每次尝试的错误
+	Errs []error
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error() + fun.ToString(e.Errs)
+}
+
+func (e *RetryError) Is(target error) bool {
+	if e.Err == target {
+		return true
+	}
+
+	for _, err := range e.Errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *RetryError) As(target any) bool {
+	for i := len(e.Errs) - 1; i >= 0; i-- {
+		if errors.As(e.Errs[i], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Unwrap 返回最后一次尝试的错误
+func (e *RetryError) Unwrap() error {
+	if len(e.Errs) > 0 {
+		return e.Errs[len(e.Errs)-1]
+	}
+
+	return nil
+}
+
+// wrapError 带有原因的错误, errors.Is(err, sentinel) 为 true, 并可通过 errors.Unwrap 获取原因
+type wrapError struct {
+	sentinel error
+	cause    error
+}
+
+func (e *wrapError) Error() string {
+	return e.sentinel.Error() + ":" + e.cause.Error()
+}
+
+func (e *wrapError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *wrapError) Unwrap() error {
+	return e.cause
+}
+
+// withCause 返回 sentinel 错误, cause 不为空时附带原因
+func withCause(sentinel error, cause error) error {
+	if cause == nil {
+		return sentinel
+	}
+
+	return &wrapError{sentinel: sentinel, cause: cause}
+}
+
+// httpError 将 httpDo 返回的错误转换为对应的错误, header 为最后一次响应头
+func httpError(resp *HttpResp, err error, header http.Header) error {
+	if err == nil {
+		return nil
+	}
+
+	if err.Error() == ErrStatusCode.Error() && resp != nil && resp.HttpResp != nil {
+		statusErr := &StatusError{StatusCode: resp.StatusCode}
+		if header != nil {
+			statusErr.RetryAfter = parseRetryAfter(header.Get("Retry-After"))
+		}
+		return statusErr
+	}
+
+	if e, exists := httpErrors[err.Error()]; exists {
+		return e
+	}
+
+	return err
+}
+
+// fetchError 返回 Fetcher 请求失败的错误, errors.Is(err, ErrRequest) 为 true
+func fetchError(resp *HttpResp, err error) error {
+	if err == nil && resp != nil && resp.HttpResp != nil && !resp.Success {
+		err = &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return withCause(ErrRequest, err)
+}
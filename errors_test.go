@@ -0,0 +1,65 @@
+package spider
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpStatusError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	_, err := HttpGetResp(ts.URL, nil, 10000)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("want StatusError 404, got %v", err)
+	}
+	if !errors.Is(err, ErrStatusCode) {
+		t.Fatalf("want ErrStatusCode, got %v", err)
+	}
+}
+
+func TestRetryError(t *testing.T) {
+	req := &HttpReq{Fetcher: NewMemoryFetcher()}
+
+	_, err := GetLinkDataWithReq("http://www.example.com/404.html", true, req, 10000, 2)
+
+	// 404 不可重试
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Errs) != 1 {
+		t.Fatalf("want RetryError with 1 attempt, got %v", err)
+	}
+	if !errors.Is(err, ErrLinkRes) || !errors.Is(err, ErrRequest) {
+		t.Fatalf("want ErrLinkRes and ErrRequest, got %v", err)
+	}
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("want StatusError 404, got %v", err)
+	}
+	t.Log(err)
+}
+
+func TestRedirectError(t *testing.T) {
+	f := NewMemoryFetcher()
+	f.Add("http://www.example.com", &MemoryPage{
+		Headers:    http.Header{"Content-Type": []string{"text/html"}},
+		Body:       []byte("<html><body>moved</body></html>"),
+		RequestURL: "https://www.example.org/",
+	})
+
+	_, err := DetectDomainWithReq("example.com", &HttpReq{Fetcher: f}, 10000, 1)
+
+	var redirectErr *RedirectError
+	if !errors.As(err, &redirectErr) || redirectErr.Domain != "example.org" || redirectErr.Meta {
+		t.Fatalf("want RedirectError example.org, got %v", err)
+	}
+	if !errors.Is(err, ErrRedirect) || err.Error() != "ErrorRedirect:example.org" {
+		t.Fatalf("want ErrRedirect, got %v", err)
+	}
+}
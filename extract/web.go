@@ -16,6 +16,14 @@ const (
 )
 
 var (
+	// FeedContentTypes RSS、Atom、JSON Feed 的媒体类型
+	FeedContentTypes = []string{
+		"application/rss+xml",
+		"application/atom+xml",
+		"application/rdf+xml",
+		"application/feed+json",
+	}
+
 	filterUrlSuffix = []string{
 		".jpg", ".jpeg", ".png", ".gif", ".bmp", ".txt", ".xml",
 		".pdf", ".doc", ".docx", ".ppt", ".pptx", ".xls", ".xlsx",
@@ -183,6 +191,46 @@ func WebDescription(doc *goquery.Document, maxLength int) string {
 	}
 }
 
+// WebFeeds 返回网页声明的 RSS、Atom、JSON Feed 链接, 即 <link rel="alternate" type="application/rss+xml">
+func WebFeeds(doc *goquery.Document, baseUrl *url.URL) []string {
+	feeds := make([]string, 0)
+	seen := make(map[string]bool)
+
+	doc.Find("link[href]").Each(func(i int, s *goquery.Selection) {
+		rel := strings.ToLower(s.AttrOr("rel", ""))
+		if !fun.SliceContains(strings.Fields(rel), "alternate") {
+			return
+		}
+
+		contentType := strings.ToLower(strings.TrimSpace(s.AttrOr("type", "")))
+		if idx := strings.Index(contentType, ";"); idx >= 0 {
+			contentType = strings.TrimSpace(contentType[:idx])
+		}
+		if !fun.SliceContains(FeedContentTypes, contentType) {
+			return
+		}
+
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if href == "" {
+			return
+		}
+		if baseUrl != nil {
+			u, err := baseUrl.Parse(href)
+			if err != nil {
+				return
+			}
+			href = u.String()
+		}
+
+		if !seen[href] {
+			seen[href] = true
+			feeds = append(feeds, href)
+		}
+	})
+
+	return feeds
+}
+
 // WebLinkTitles 返回网页链接和锚文本
 func WebLinkTitles(doc *goquery.Document, baseUrl *url.URL, strictDomain bool) (map[string]string, map[string]string) {
 	var linkTitles = make(map[string]string)
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/url"
 	"path"
+	"strings"
 	"testing"
 	"unicode/utf8"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/x-funs/go-fun"
 )
 
@@ -60,3 +62,51 @@ func BenchmarkFilterUrl(b *testing.B) {
 		// url.Parse("https://www.163.com/news/article/HEAJM4F1000189FH.html")
 	}
 }
+
+func TestWebFeeds(t *testing.T) {
+	html := `<html><head>
+<link rel="alternate" type="application/rss+xml" title="RSS" href="/rss.xml">
+<link rel="alternate" type="application/atom+xml" href="http://www.163.com/atom.xml">
+<link rel="alternate" type="application/feed+json; charset=utf-8" href="feed.json">
+<link rel="alternate" type="application/rss+xml" href="/rss.xml">
+<link rel="alternate" type="application/json" href="http://www.163.com/wp-json/wp/v2/pages/2">
+<link rel="alternate" hreflang="en" href="/en/">
+<link rel="stylesheet" type="text/css" href="/a.css">
+</head><body></body></html>`
+
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+	baseUrl, _ := fun.UrlParse("http://www.163.com/news/")
+
+	feeds := WebFeeds(doc, baseUrl)
+	want := []string{"http://www.163.com/rss.xml", "http://www.163.com/atom.xml", "http://www.163.com/news/feed.json"}
+	if len(feeds) != len(want) {
+		t.Fatalf("want %v, got %v", want, feeds)
+	}
+	for i := range want {
+		if feeds[i] != want[i] {
+			t.Errorf("want %s, got %s", want[i], feeds[i])
+		}
+	}
+}
+
+func TestWebLinkTitlesFeed(t *testing.T) {
+	html := `<html><head><link rel="alternate" type="application/rss+xml" href="/news.rss"></head><body>
+<a href="/news.rss">新闻订阅</a>
+<a href="/news/2022/0901/1001.html">示例新闻标题示例新闻标题</a>
+</body></html>`
+
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+	baseUrl, _ := fun.UrlParse("http://www.163.com/")
+
+	linkTitles, _ := WebLinkTitles(doc, baseUrl, true)
+	if _, exist := linkTitles["http://www.163.com/news.rss"]; exist {
+		t.Errorf("want .rss filtered, got %v", linkTitles)
+	}
+	if _, exist := linkTitles["http://www.163.com/news/2022/0901/1001.html"]; !exist {
+		t.Errorf("want article link, got %v", linkTitles)
+	}
+
+	if feeds := WebFeeds(doc, baseUrl); len(feeds) != 1 || feeds[0] != "http://www.163.com/news.rss" {
+		t.Errorf("want feed from WebFeeds, got %v", feeds)
+	}
+}
@@ -0,0 +1,389 @@
+package spider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/suosi-inc/go-pkg-spider/extract"
+	"github.com/x-funs/go-fun"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	FeedRss  = "rss"
+	FeedAtom = "atom"
+	FeedJson = "json"
+)
+
+var (
+	// feedContentTypes 获取 Feed 时允许的 Content-Type, 部分站点使用 text/xml、application/xml 返回 Feed
+	feedContentTypes = append([]string{"text/", "application/xml"}, extract.FeedContentTypes...)
+)
+
+// FeedItem Feed 条目
+type FeedItem struct {
+	// 链接
+	Link string
+
+	// 标题
+	Title string
+
+	// 发布时间
+	Published time.Time
+
+	// 摘要纯文本
+	Summary string
+}
+
+// Feed 解析后的 RSS、Atom 或 JSON Feed
+type Feed struct {
+	// 类型 rss、atom、json
+	Type string
+
+	// 标题
+	Title string
+
+	// 网站链接
+	Link string
+
+	// 条目
+	Items []*FeedItem
+}
+
+type rssXml struct {
+	XMLName xml.Name
+	Channel struct {
+		Title string       `xml:"title"`
+		Link  string       `xml:"link"`
+		Items []rssItemXml `xml:"item"`
+	} `xml:"channel"`
+	// RSS 1.0 的 item 与 channel 同级
+	Items []rssItemXml `xml:"item"`
+}
+
+type rssItemXml struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Guid        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"date"`
+	Description string `xml:"description"`
+}
+
+type atomXml struct {
+	Title   string        `xml:"title"`
+	Links   []atomLinkXml `xml:"link"`
+	Entries []struct {
+		Title     string        `xml:"title"`
+		Links     []atomLinkXml `xml:"link"`
+		Published string        `xml:"published"`
+		Updated   string        `xml:"updated"`
+		Summary   string        `xml:"summary"`
+		Content   string        `xml:"content"`
+	} `xml:"entry"`
+}
+
+type atomLinkXml struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type jsonFeed struct {
+	Title       string `json:"title"`
+	HomePageUrl string `json:"home_page_url"`
+	Items       []struct {
+		Url           string `json:"url"`
+		ExternalUrl   string `json:"external_url"`
+		Title         string `json:"title"`
+		Summary       string `json:"summary"`
+		ContentText   string `json:"content_text"`
+		ContentHtml   string `json:"content_html"`
+		DatePublished string `json:"date_published"`
+		DateModified  string `json:"date_modified"`
+	} `json:"items"`
+}
+
+// ParseFeed 解析 RSS 2.0(兼容 RSS 1.0)、Atom 和 JSON Feed, baseUrl 用于补全相对链接, 可以为空
+func ParseFeed(body []byte, baseUrl *url.URL) (*Feed, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, ErrDocParse
+	}
+
+	var feed *Feed
+	var err error
+	if body[0] == '{' {
+		feed, err = parseJsonFeed(body)
+	} else {
+		feed, err = parseXmlFeed(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 补全链接
+	if baseUrl != nil {
+		feed.Link = feedUrl(baseUrl, feed.Link)
+		for _, item := range feed.Items {
+			item.Link = feedUrl(baseUrl, item.Link)
+		}
+	}
+
+	return feed, nil
+}
+
+func parseXmlFeed(body []byte) (*Feed, error) {
+	// 根据根节点判断类型
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := newFeedDecoder(body).Decode(&root); err != nil {
+		return nil, ErrDocParse
+	}
+
+	switch strings.ToLower(root.XMLName.Local) {
+	case "feed":
+		var a atomXml
+		if err := newFeedDecoder(body).Decode(&a); err != nil {
+			return nil, ErrDocParse
+		}
+
+		feed := &Feed{Type: FeedAtom, Title: feedText(a.Title), Link: atomLink(a.Links)}
+		for _, entry := range a.Entries {
+			published := parseFeedTime(entry.Published)
+			if published.IsZero() {
+				published = parseFeedTime(entry.Updated)
+			}
+			summary := entry.Summary
+			if summary == "" {
+				summary = entry.Content
+			}
+			feed.Items = append(feed.Items, &FeedItem{
+				Link:      atomLink(entry.Links),
+				Title:     feedText(entry.Title),
+				Published: published,
+				Summary:   feedText(summary),
+			})
+		}
+		return feed, nil
+	case "rss", "rdf":
+		var r rssXml
+		if err := newFeedDecoder(body).Decode(&r); err != nil {
+			return nil, ErrDocParse
+		}
+
+		feed := &Feed{Type: FeedRss, Title: feedText(r.Channel.Title), Link: strings.TrimSpace(r.Channel.Link)}
+		for _, item := range append(r.Channel.Items, r.Items...) {
+			link := strings.TrimSpace(item.Link)
+			if link == "" && strings.HasPrefix(item.Guid, "http") {
+				link = strings.TrimSpace(item.Guid)
+			}
+			published := parseFeedTime(item.PubDate)
+			if published.IsZero() {
+				published = parseFeedTime(item.Date)
+			}
+			feed.Items = append(feed.Items, &FeedItem{
+				Link:      link,
+				Title:     feedText(item.Title),
+				Published: published,
+				Summary:   feedText(item.Description),
+			})
+		}
+		return feed, nil
+	}
+
+	return nil, ErrDocParse
+}
+
+func parseJsonFeed(body []byte) (*Feed, error) {
+	var j jsonFeed
+	if err := json.Unmarshal(body, &j); err != nil {
+		return nil, ErrDocParse
+	}
+
+	feed := &Feed{Type: FeedJson, Title: j.Title, Link: j.HomePageUrl}
+	for _, item := range j.Items {
+		link := item.Url
+		if link == "" {
+			link = item.ExternalUrl
+		}
+		published := parseFeedTime(item.DatePublished)
+		if published.IsZero() {
+			published = parseFeedTime(item.DateModified)
+		}
+		summary := item.Summary
+		if summary == "" {
+			summary = item.ContentText
+		}
+		if summary == "" {
+			summary = item.ContentHtml
+		}
+		feed.Items = append(feed.Items, &FeedItem{
+			Link:      strings.TrimSpace(link),
+			Title:     feedText(item.Title),
+			Published: published,
+			Summary:   feedText(summary),
+		})
+	}
+
+	return feed, nil
+}
+
+// DiscoverFeeds 获取页面并返回页面声明的 Feed 链接
+func DiscoverFeeds(ctx context.Context, urlStr string, req *HttpReq, timeout int) ([]string, error) {
+	if req == nil {
+		req = &HttpReq{
+			HttpReq: &fun.HttpReq{
+				MaxContentLength: HttpDefaultMaxContentLength,
+				MaxRedirect:      3,
+			},
+			ForceTextContentType: true,
+		}
+	}
+
+	resp, err := req.fetcher().Fetch(ctx, urlStr, req, timeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	if resp != nil && err == nil && resp.Success {
+		doc, docErr := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
+		if docErr != nil {
+			return nil, ErrDocParse
+		}
+		return extract.WebFeeds(doc, resp.RequestURL), nil
+	}
+
+	return nil, fetchError(resp, err)
+}
+
+// GetFeed 获取并解析 Feed
+func GetFeed(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*Feed, error) {
+	r := &HttpReq{
+		HttpReq: &fun.HttpReq{
+			MaxContentLength:    HttpDefaultMaxContentLength,
+			MaxRedirect:         3,
+			AllowedContentTypes: feedContentTypes,
+		},
+		DisableCharset: true,
+	}
+	inheritReq(r, req)
+
+	resp, err := r.fetcher().Fetch(ctx, urlStr, r, timeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	if resp != nil && err == nil && resp.Success {
+		return ParseFeed(resp.Body, resp.RequestURL)
+	}
+
+	return nil, fetchError(resp, err)
+}
+
+// FeedLinkRes 将 Feed 条目转换为内容页链接, domain 不为空时只保留该主域名下的链接
+func FeedLinkRes(feed *Feed, domain string) *extract.LinkRes {
+	linkRes := &extract.LinkRes{
+		Content: make(map[string]string),
+		List:    make(map[string]string),
+		Unknown: make(map[string]string),
+		None:    make(map[string]string),
+	}
+
+	if feed == nil {
+		return linkRes
+	}
+
+	for _, item := range feed.Items {
+		u, err := url.Parse(item.Link)
+		if err != nil || !u.IsAbs() {
+			continue
+		}
+		if domain != "" && extract.DomainTop(u.Hostname()) != domain {
+			continue
+		}
+
+		linkRes.Content[item.Link] = item.Title
+	}
+
+	return linkRes
+}
+
+func newFeedDecoder(body []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	return decoder
+}
+
+// atomLink 返回 rel=alternate 或没有 rel 的链接
+func atomLink(links []atomLinkXml) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+
+	return ""
+}
+
+// feedText 返回纯文本, 去除 HTML 标签
+func feedText(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "<") {
+		if doc, err := goquery.NewDocumentFromReader(strings.NewReader(s)); err == nil {
+			s = strings.TrimSpace(doc.Text())
+		}
+	}
+
+	return fun.RemoveLines(s)
+}
+
+// feedUrl 补全相对链接
+func feedUrl(baseUrl *url.URL, link string) string {
+	if link == "" {
+		return link
+	}
+
+	if u, err := baseUrl.Parse(link); err == nil {
+		return u.String()
+	}
+
+	return link
+}
+
+// feedTimeLayouts RSS(RFC 822) 时间格式
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04 -0700",
+	"02 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+}
+
+// parseFeedTime 解析 Feed 时间, 支持 RFC 822 和 W3C Datetime, 失败时返回零值
+func parseFeedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return parseSitemapTime(value)
+}
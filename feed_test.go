@@ -0,0 +1,150 @@
+package spider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/x-funs/go-fun"
+)
+
+const testRss = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+  <title>示例新闻网</title>
+  <link>http://www.example.com/</link>
+  <item>
+    <title>国务院办公厅印发关于进一步优化营商环境的意见</title>
+    <link>http://www.example.com/news/2022/0901/1001.html</link>
+    <pubDate>Thu, 01 Sep 2022 10:00:00 +0800</pubDate>
+    <description><![CDATA[<p>为进一步<b>优化营商环境</b></p>]]></description>
+  </item>
+  <item>
+    <title>相对链接</title>
+    <guid>/news/2022/0901/1002.html</guid>
+    <link>/news/2022/0901/1002.html</link>
+    <pubDate>Thu, 1 Sep 2022 11:00:00 GMT</pubDate>
+  </item>
+</channel>
+</rss>`
+
+const testAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example News</title>
+  <link rel="self" href="http://www.example.com/atom.xml"/>
+  <link href="http://www.example.com/"/>
+  <entry>
+    <title>Atom entry</title>
+    <link rel="alternate" href="http://www.example.com/news/a.html"/>
+    <updated>2022-09-02T08:00:00Z</updated>
+    <summary>Atom summary</summary>
+  </entry>
+</feed>`
+
+const testJsonFeed = `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Example News",
+  "home_page_url": "http://www.example.com/",
+  "items": [
+    {"id": "1", "url": "http://www.example.com/news/j.html", "title": "JSON entry", "content_text": "JSON summary", "date_published": "2022-09-03T08:00:00+08:00"}
+  ]
+}`
+
+func TestParseFeed(t *testing.T) {
+	baseUrl, _ := fun.UrlParse("http://www.example.com/rss.xml")
+
+	rss, err := ParseFeed([]byte(testRss), baseUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rss.Type != FeedRss || rss.Title != "示例新闻网" || len(rss.Items) != 2 {
+		t.Fatalf("unexpected rss %+v", rss)
+	}
+	item := rss.Items[0]
+	if item.Link != testArticleUrl || item.Summary != "为进一步优化营商环境" {
+		t.Errorf("unexpected rss item %+v", item)
+	}
+	if want := time.Date(2022, 9, 1, 2, 0, 0, 0, time.UTC); !item.Published.Equal(want) {
+		t.Errorf("want published %v, got %v", want, item.Published)
+	}
+	if rss.Items[1].Link != "http://www.example.com/news/2022/0901/1002.html" || rss.Items[1].Published.IsZero() {
+		t.Errorf("unexpected rss item %+v", rss.Items[1])
+	}
+
+	atom, err := ParseFeed([]byte(testAtom), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atom.Type != FeedAtom || atom.Link != "http://www.example.com/" || len(atom.Items) != 1 {
+		t.Fatalf("unexpected atom %+v", atom)
+	}
+	if item := atom.Items[0]; item.Link != "http://www.example.com/news/a.html" || item.Summary != "Atom summary" || item.Published.IsZero() {
+		t.Errorf("unexpected atom item %+v", item)
+	}
+
+	jsonFeed, err := ParseFeed([]byte(testJsonFeed), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonFeed.Type != FeedJson || len(jsonFeed.Items) != 1 {
+		t.Fatalf("unexpected json feed %+v", jsonFeed)
+	}
+	if item := jsonFeed.Items[0]; item.Title != "JSON entry" || item.Summary != "JSON summary" || item.Published.IsZero() {
+		t.Errorf("unexpected json feed item %+v", item)
+	}
+
+	if _, err := ParseFeed([]byte("<html></html>"), nil); err == nil {
+		t.Error("want error for html")
+	}
+}
+
+func newTestFeedFetcher() *MemoryFetcher {
+	f := newTestFetcher()
+	home := strings.Replace(testHomeHtml(), "<head>", `<head><link rel="alternate" type="application/rss+xml" href="/rss.xml">`, 1)
+	f.AddHtml(testHomeUrl, home)
+	f.Add("http://www.example.com/rss.xml", &MemoryPage{
+		Headers: http.Header{"Content-Type": []string{"application/rss+xml"}},
+		Body:    []byte(testRss),
+	})
+
+	return f
+}
+
+func TestGetFeed(t *testing.T) {
+	req := &HttpReq{Fetcher: newTestFeedFetcher()}
+
+	feeds, err := DiscoverFeeds(context.Background(), testHomeUrl, req, 1000)
+	if err != nil || len(feeds) != 1 || feeds[0] != "http://www.example.com/rss.xml" {
+		t.Fatalf("unexpected feeds %v %v", feeds, err)
+	}
+
+	feed, err := GetFeed(context.Background(), feeds[0], req, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linkRes := FeedLinkRes(feed, "example.com")
+	if len(linkRes.Content) != 2 || linkRes.Content[testArticleUrl] != "国务院办公厅印发关于进一步优化营商环境的意见" {
+		t.Errorf("unexpected link res %v", linkRes.Content)
+	}
+
+	domainRes, err := DetectDomainWithReq("example.com", req, 1000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domainRes.Feeds) != 1 || domainRes.Feeds[0] != "http://www.example.com/rss.xml" {
+		t.Errorf("unexpected domain feeds %v", domainRes.Feeds)
+	}
+}
+
+func TestNewsSpiderWithFeed(t *testing.T) {
+	// 深度为 0, 只采集 Feed 中的链接
+	n := NewNewsSpider(testHomeUrl, 0, nil, nil, WithFetcher(newTestFeedFetcher()), WithRetryTime(1), WithFeed(true))
+
+	contents := collectNews(t, n)
+	if len(contents) != 1 || contents[0].Url != testArticleUrl {
+		t.Fatalf("want 1 content from %s, got %d", testArticleUrl, len(contents))
+	}
+}
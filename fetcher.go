@@ -0,0 +1,189 @@
+package spider
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/x-funs/go-fun"
+)
+
+// Fetcher 页面获取接口, GetNews、GetLinkData、DetectDomain、NewsSpider 等均通过 Fetcher 获取页面
+// 可替换为自定义的采集器、代理池、本地缓存或 WARC 归档等, 返回的 HttpResp.Body 应为 UTF-8
+type Fetcher interface {
+	Fetch(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*HttpResp, error)
+}
+
+// FetcherFunc 函数形式的 Fetcher
+type FetcherFunc func(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*HttpResp, error)
+
+// Fetch 实现 Fetcher
+func (f FetcherFunc) Fetch(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*HttpResp, error) {
+	return f(ctx, urlStr, req, timeout)
+}
+
+// HttpFetcher 默认的 Fetcher, 使用 HttpGetRespCtx 请求
+type HttpFetcher struct{}
+
+// Fetch 实现 Fetcher
+func (f *HttpFetcher) Fetch(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*HttpResp, error) {
+	return HttpGetRespCtx(ctx, urlStr, req, timeout)
+}
+
+// DefaultFetcher 默认全局使用的 Fetcher
+var DefaultFetcher Fetcher = &HttpFetcher{}
+
+// inheritReq 继承 req 的采集器、限速器、Transport、代理、缓存、TLS 配置、中间件、Cookie 容器和请求头, 用于获取 robots.txt、sitemap、Feed 等资源
+func inheritReq(r *HttpReq, req *HttpReq) {
+	if req == nil {
+		return
+	}
+
+	r.Fetcher = req.Fetcher
+	r.Limiter = req.Limiter
+	r.TransportProfile = req.TransportProfile
+	r.Proxy = req.Proxy
+	r.Cache = req.Cache
+	r.TLS = req.TLS
+	r.Middlewares = req.Middlewares
+	if req.HttpReq != nil {
+		r.UserAgent = req.UserAgent
+		r.Headers = req.Headers
+		r.Transport = req.Transport
+		r.Jar = req.Jar
+	}
+}
+
+// fetcher 返回 HttpReq 指定的 Fetcher, 未指定时返回 DefaultFetcher
+func (r *HttpReq) fetcher() Fetcher {
+	if r != nil && r.Fetcher != nil {
+		return r.Fetcher
+	}
+
+	return DefaultFetcher
+}
+
+// MemoryPage MemoryFetcher 中的页面
+type MemoryPage struct {
+	// Http 状态码, 为 0 时为 200
+	StatusCode int
+
+	// 响应头
+	Headers http.Header
+
+	// 响应体, 原始编码
+	Body []byte
+
+	// 最后请求地址, 用于模拟跳转, 为空时为请求地址
+	RequestURL string
+}
+
+// MemoryFetcher 内存 Fetcher, 用于测试或重放已保存的页面
+type MemoryFetcher struct {
+	mu    sync.RWMutex
+	pages map[string]*MemoryPage
+	hits  map[string]int
+}
+
+// NewMemoryFetcher 初始化 MemoryFetcher
+func NewMemoryFetcher() *MemoryFetcher {
+	return &MemoryFetcher{
+		pages: make(map[string]*MemoryPage),
+		hits:  make(map[string]int),
+	}
+}
+
+// Add 添加页面
+func (m *MemoryFetcher) Add(urlStr string, page *MemoryPage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pages[urlStr] = page
+}
+
+// AddHtml 添加 UTF-8 编码的 HTML 页面
+func (m *MemoryFetcher) AddHtml(urlStr string, html string) {
+	m.Add(urlStr, &MemoryPage{
+		Headers: http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:    []byte(html),
+	})
+}
+
+// Hits 返回地址被请求的次数
+func (m *MemoryFetcher) Hits(urlStr string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.hits[urlStr]
+}
+
+// Fetch 实现 Fetcher, 不存在的页面返回 404
+func (m *MemoryFetcher) Fetch(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*HttpResp, error) {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	m.mu.Lock()
+	m.hits[urlStr]++
+	page, exists := m.pages[urlStr]
+	if !exists {
+		// 兼容末尾斜杠
+		if strings.HasSuffix(urlStr, fun.SLASH) {
+			page, exists = m.pages[strings.TrimSuffix(urlStr, fun.SLASH)]
+		} else {
+			page, exists = m.pages[urlStr+fun.SLASH]
+		}
+	}
+	m.mu.Unlock()
+
+	if !exists {
+		page = &MemoryPage{StatusCode: http.StatusNotFound}
+	}
+
+	requestURL := page.RequestURL
+	if requestURL == "" {
+		requestURL = urlStr
+	}
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode := page.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	headers := page.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+
+	body := make([]byte, len(page.Body))
+	copy(body, page.Body)
+
+	httpResp := &HttpResp{
+		HttpResp: &fun.HttpResp{
+			Success:       statusCode >= 200 && statusCode < 300,
+			StatusCode:    statusCode,
+			Body:          body,
+			ContentLength: int64(len(body)),
+			Headers:       &headers,
+			RequestURL:    u,
+		},
+	}
+
+	if !httpResp.Success {
+		return httpResp, &StatusError{StatusCode: statusCode}
+	}
+
+	if req == nil || !req.DisableCharset {
+		if err := httpRespCharset(httpResp); err != nil {
+			return httpResp, err
+		}
+	}
+
+	return httpResp, nil
+}
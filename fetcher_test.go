@@ -0,0 +1,181 @@
+package spider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	testHomeUrl    = "http://www.example.com"
+	testArticleUrl = "http://www.example.com/news/2022/0901/1001.html"
+)
+
+// testHomeHtml 测试用首页
+func testHomeHtml() string {
+	var links strings.Builder
+	for i := 1; i <= 20; i++ {
+		links.WriteString(fmt.Sprintf(`<li><a href="/news/2022/0901/%d.html">国务院办公厅印发关于进一步优化营商环境的第%d条重要意见</a></li>`, 1000+i, i))
+	}
+	links.WriteString(`<li><a href="/news/">新闻</a></li><li><a href="/finance/">财经</a></li>`)
+	links.WriteString(`<li><a href="http://sports.example.com/">体育</a></li>`)
+
+	return `<html><head><title>示例新闻网_权威新闻门户</title></head><body><ul>` + links.String() + `</ul></body></html>`
+}
+
+// testArticleHtml 测试用内容页
+func testArticleHtml() string {
+	var ps strings.Builder
+	for i := 1; i <= 8; i++ {
+		ps.WriteString(fmt.Sprintf("<p>第%d项措施：国务院办公厅近日印发关于进一步优化营商环境降低市场主体制度性交易成本的意见。%s</p>", i, strings.Repeat("进一步激发市场主体活力。", i)))
+	}
+
+	return `<html><head><title>国务院办公厅印发关于进一步优化营商环境的第1条重要意见_示例新闻网</title></head><body>` +
+		`<h1>国务院办公厅印发关于进一步优化营商环境的第1条重要意见</h1><div class="time">2022-09-01 10:20:30</div>` +
+		`<div class="nav"><a href="/">首页</a><a href="/news/">新闻</a></div>` +
+		`<div class="content">` + ps.String() + `</div><div class="footer">版权所有 示例新闻网</div></body></html>`
+}
+
+// skipOnline 访问外网的测试默认跳过, 设置环境变量 SPIDER_ONLINE_TEST=1 时运行
+func skipOnline(tb testing.TB) {
+	if testing.Short() || os.Getenv("SPIDER_ONLINE_TEST") == "" {
+		tb.Skip("skipping online test, set SPIDER_ONLINE_TEST=1 to run")
+	}
+}
+
+func newTestFetcher() *MemoryFetcher {
+	f := NewMemoryFetcher()
+	f.AddHtml(testHomeUrl, testHomeHtml())
+	f.AddHtml(testArticleUrl, testArticleHtml())
+
+	return f
+}
+
+func TestMemoryFetcher(t *testing.T) {
+	f := NewMemoryFetcher()
+	f.Add(testHomeUrl, &MemoryPage{
+		Headers: http.Header{"Content-Type": []string{"text/html"}},
+		Body:    []byte("<html><head><meta charset=\"gbk\"></head><body>\xd6\xd0\xb9\xfa</body></html>"),
+	})
+
+	resp, err := f.Fetch(context.Background(), testHomeUrl+"/", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Charset.Charset != "GBK" || !strings.Contains(string(resp.Body), "中国") {
+		t.Fatalf("charset %v, body %s", resp.Charset, resp.Body)
+	}
+
+	resp, err = f.Fetch(context.Background(), "http://www.example.com/404.html", nil, 0)
+	if err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("want 404, got %v", err)
+	}
+
+	if f.Hits(testHomeUrl+"/") != 1 {
+		t.Fatalf("want 1 hit, got %d", f.Hits(testHomeUrl+"/"))
+	}
+}
+
+func TestGetNewsWithFetcher(t *testing.T) {
+	req := &HttpReq{Fetcher: newTestFetcher()}
+
+	news, resp, err := GetNewsWithReq(testArticleUrl, "", req, 10000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log(resp.Charset)
+	t.Log(news.Title)
+	t.Log(news.TimeLocal)
+
+	if news.Lang != "zh" {
+		t.Errorf("want lang zh, got %s", news.Lang)
+	}
+	if !strings.Contains(news.Title, "优化营商环境") {
+		t.Errorf("unexpected title %s", news.Title)
+	}
+	if !strings.Contains(news.Content, "市场主体") {
+		t.Errorf("unexpected content %s", news.Content)
+	}
+}
+
+func TestGetLinkDataWithFetcher(t *testing.T) {
+	req := &HttpReq{Fetcher: newTestFetcher()}
+
+	linkData, err := GetLinkDataWithReq(testHomeUrl, true, req, 10000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(linkData.LinkRes.Content) != 20 {
+		t.Errorf("want 20 content links, got %d", len(linkData.LinkRes.Content))
+	}
+	if !linkData.SubDomains["sports.example.com"] {
+		t.Errorf("want subdomain sports.example.com, got %v", linkData.SubDomains)
+	}
+}
+
+func TestDetectDomainWithFetcher(t *testing.T) {
+	req := &HttpReq{Fetcher: newTestFetcher()}
+
+	domainRes, err := DetectDomainWithReq("example.com", req, 10000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !domainRes.State || domainRes.HomeDomain != "www.example.com" || domainRes.Lang.Lang != "zh" {
+		t.Errorf("unexpected domainRes %+v", domainRes)
+	}
+	if domainRes.ContentCount != 20 {
+		t.Errorf("want 20 content links, got %d", domainRes.ContentCount)
+	}
+}
+
+// collectNews 运行 NewsSpider 并收集采集到的内容页, GetContentNews 返回时所有数据已处理完成
+func collectNews(t *testing.T, n *NewsSpider) []*NewsContent {
+	t.Helper()
+
+	// ProcessFunc 只在一个协程中调用
+	var contents []*NewsContent
+	n.ProcessFunc = func(data ...any) {
+		if c, ok := data[0].(*NewsContent); ok {
+			contents = append(contents, c)
+		}
+	}
+	n.GetContentNews()
+
+	return contents
+}
+
+func TestNewsSpiderWithFetcher(t *testing.T) {
+	n := NewNewsSpider(testHomeUrl, 1, nil, nil, WithFetcher(newTestFetcher()), WithRetryTime(1))
+
+	contents := collectNews(t, n)
+	if len(contents) != 1 || contents[0].Url != testArticleUrl {
+		t.Fatalf("want 1 content from %s, got %d", testArticleUrl, len(contents))
+	}
+}
+
+func TestNewsSpiderWithCookieJar(t *testing.T) {
+	ts := newTestSessionServer()
+	defer ts.Close()
+
+	// 作为代理访问 www.example.com
+	crawl := func(options ...Option) []*NewsContent {
+		proxy, _ := NewProxyPool(ProxyRoundRobin, ts.URL)
+		options = append(options, WithProxyPool(proxy), WithHostLimiter(nil), WithRetryTime(1), WithTimeOut(5000))
+		return collectNews(t, NewNewsSpider(testHomeUrl, 1, nil, nil, options...))
+	}
+
+	if contents := crawl(); len(contents) != 0 {
+		t.Errorf("want no content without session, got %d", len(contents))
+	}
+
+	contents := crawl(WithCookieJar(nil))
+	if len(contents) != 1 || contents[0].Url != testArticleUrl {
+		t.Fatalf("want 1 content from %s with session, got %d", testArticleUrl, len(contents))
+	}
+}
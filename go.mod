@@ -1,14 +1,17 @@
 module github.com/suosi-inc/go-pkg-spider
 
-go 1.18
+go 1.22
 
 require (
 	github.com/PuerkitoBio/goquery v1.8.1
+	github.com/andybalholm/brotli v1.1.1
+	github.com/klauspost/compress v1.18.0
 	github.com/microcosm-cc/bluemonday v1.0.26
 	github.com/suosi-inc/chardet v0.1.0
 	github.com/suosi-inc/lingua-go v1.0.51
 	github.com/x-funs/go-fun v0.94.0
 	golang.org/x/net v0.19.0
+	golang.org/x/text v0.17.0
 )
 
 require (
@@ -16,5 +19,4 @@ require (
 	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/gorilla/css v1.0.1 // indirect
 	github.com/saintfish/chardet v0.0.0-20120816061221-3af4cd4741ca // indirect
-	golang.org/x/text v0.17.0 // indirect
 )
@@ -1,20 +1,26 @@
 package spider
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
+	"io"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/x-funs/go-fun"
+	"golang.org/x/net/publicsuffix"
 )
 
 const (
 	HttpDefaultTimeOut          = 10000
 	HttpDefaultMaxContentLength = 10 * 1024 * 1024
 	HttpDefaultUserAgent        = "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/103.0.0.0 Safari/537.36"
-	HttpDefaultAcceptEncoding   = "gzip, deflate"
+	HttpDefaultAcceptEncoding   = "gzip, deflate, br, zstd"
 )
 
 var (
@@ -37,6 +43,35 @@ type HttpReq struct {
 
 	// 强制 ContentType 为文本类型
 	ForceTextContentType bool
+
+	// 页面获取方式, 为空时使用 DefaultFetcher, 仅对 GetNews、GetLinkData、DetectDomain 等高层方法生效
+	Fetcher Fetcher
+
+	// 重试策略, 不为空时忽略 retry 参数, 仅对 GetNews、GetLinkData、DetectDomain 等高层方法生效
+	RetryPolicy *RetryPolicy
+
+	// 主机限速器, 按主机限制请求速率和并发数, 为空时使用 DefaultHostLimiter
+	Limiter *HostLimiter
+
+	// Transport 为空时使用的 Transport 配置, 默认为 TransportDefault
+	TransportProfile TransportProfile
+
+	// 代理池, 不为空时每次请求从代理池中选择代理
+	Proxy *ProxyPool
+
+	// 响应缓存, 不为空时缓存带有 ETag 或 Last-Modified 的 GET 响应, 并发送条件请求
+	Cache CacheStore
+
+	// TLS 配置, 为空时不校验证书
+	TLS *TLSConfig
+
+	// robots.txt 缓存, 不为空时 GetLinkData 会将 robots.txt 禁止的链接移到 LinkData.Filters
+	Robots *RobotsCache
+
+	// 请求中间件, 在全局中间件内层, 按顺序由外到内
+	Middlewares []Middleware
+	// 记录请求耗时和网络信息到 HttpResp.Trace
+	Trace bool
 }
 
 type HttpResp struct {
@@ -44,6 +79,25 @@ type HttpResp struct {
 
 	// 字符集
 	Charset CharsetRes
+
+	// 使用的代理, 隐藏密码
+	Proxy string
+
+	// 是否来自缓存(304 Not Modified)
+	FromCache bool
+
+	// 最后一次响应的 TLS 连接状态, 非 TLS 请求时为空
+	TLS *tls.ConnectionState
+
+	// TLS 证书校验结果
+	TLSVerify TLSVerifyResult
+
+	// 响应超过最大长度被截断, 仅流式请求时设置
+	Truncated bool
+	// 请求耗时和网络信息, 仅设置 HttpReq.Trace 时记录
+	Trace *HttpTrace
+	// HTTP 跳转链, 按跳转顺序
+	Redirects []HttpRedirect
 }
 
 // HttpDefaultTransport 默认全局使用的 http.Transport
@@ -56,6 +110,13 @@ var HttpDefaultTransport = &http.Transport{
 	TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
 }
 
+// NewCookieJar 创建按公共后缀列表隔离域名的 Cookie 容器, 可设置到 HttpReq.Jar 在多次请求间保持会话
+func NewCookieJar() http.CookieJar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+
+	return jar
+}
+
 // HttpGet 参数为请求地址 (HttpReq, 超时时间)
 // HttpGet(url)、HttpGet(url, HttpReq)、HttpGet(url, timeout)、HttpGet(url, HttpReq, timeout)
 // 返回 body, 错误信息
@@ -83,7 +144,7 @@ func HttpGet(urlStr string, args ...any) ([]byte, error) {
 
 	}
 
-	return nil, errors.New("http get params error")
+	return nil, ErrHttpParams
 }
 
 // HttpGetDo Http Get 请求, 参数为请求地址, HttpReq, 超时时间(毫秒)
@@ -100,12 +161,212 @@ func HttpGetDo(urlStr string, r *HttpReq, timeout int) ([]byte, error) {
 // HttpGetResp Http Get 请求, 参数为请求地址, HttpReq, 超时时间(毫秒)
 // 返回 HttpResp, 错误信息
 func HttpGetResp(urlStr string, r *HttpReq, timeout int) (*HttpResp, error) {
-	req, err := http.NewRequest(http.MethodGet, urlStr, nil)
+	return HttpGetRespCtx(context.Background(), urlStr, r, timeout)
+}
+
+// HttpGetRespCtx Http Get 请求, 参数为 context.Context, 请求地址, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpGetRespCtx(ctx context.Context, urlStr string, r *HttpReq, timeout int) (*HttpResp, error) {
+	return HttpMethodRespCtx(ctx, http.MethodGet, urlStr, nil, r, timeout)
+}
+
+// HttpPost 参数为请求地址 (body io.Reader, HttpReq, 超时时间)
+// HttpPost(url)、HttpPost(url, body)、HttpPost(url, timeout)、HttpPost(url, body, timeout)、HttpPost(url, body, HttpReq)、HttpPost(url, body, HttpReq, timeout)
+// 返回 body, 错误信息
+func HttpPost(urlStr string, args ...any) ([]byte, error) {
+	var body io.Reader
+	if len(args) > 0 {
+		if v, ok := args[0].(io.Reader); ok {
+			body = v
+			args = args[1:]
+		}
+	}
+
+	if r, timeout, ok := httpArgs(args); ok {
+		return HttpPostDo(urlStr, body, r, timeout)
+	}
+
+	return nil, ErrHttpParams
+}
+
+// HttpPostDo Http Post 请求, 参数为请求地址, body, HttpReq, 超时时间(毫秒)
+// 返回 body, 错误信息
+func HttpPostDo(urlStr string, body io.Reader, r *HttpReq, timeout int) ([]byte, error) {
+	resp, err := HttpPostResp(urlStr, body, r, timeout)
 	if err != nil {
 		return nil, err
+	} else {
+		return resp.Body, nil
+	}
+}
+
+// HttpPostResp Http Post 请求, 参数为请求地址, body, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpPostResp(urlStr string, body io.Reader, r *HttpReq, timeout int) (*HttpResp, error) {
+	return HttpPostRespCtx(context.Background(), urlStr, body, r, timeout)
+}
+
+// HttpPostRespCtx Http Post 请求, 参数为 context.Context, 请求地址, body, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpPostRespCtx(ctx context.Context, urlStr string, body io.Reader, r *HttpReq, timeout int) (*HttpResp, error) {
+	return HttpMethodRespCtx(ctx, http.MethodPost, urlStr, body, r, timeout)
+}
+
+// HttpPostForm 参数为请求地址 (表单 map[string]string, HttpReq, 超时时间)
+// HttpPostForm(url)、HttpPostForm(url, posts)、HttpPostForm(url, timeout)、HttpPostForm(url, posts, timeout)、HttpPostForm(url, posts, HttpReq)、HttpPostForm(url, posts, HttpReq, timeout)
+// 返回 body, 错误信息
+func HttpPostForm(urlStr string, args ...any) ([]byte, error) {
+	var posts map[string]string
+	if len(args) > 0 {
+		if v, ok := args[0].(map[string]string); ok {
+			posts = v
+			args = args[1:]
+		}
+	}
+
+	if r, timeout, ok := httpArgs(args); ok {
+		return HttpPostFormDo(urlStr, posts, r, timeout)
+	}
+
+	return nil, ErrHttpParams
+}
+
+// HttpPostFormDo Http Post 表单请求, 参数为请求地址, 表单, HttpReq, 超时时间(毫秒)
+// 返回 body, 错误信息
+func HttpPostFormDo(urlStr string, posts map[string]string, r *HttpReq, timeout int) ([]byte, error) {
+	resp, err := HttpPostFormResp(urlStr, posts, r, timeout)
+	if err != nil {
+		return nil, err
+	} else {
+		return resp.Body, nil
+	}
+}
+
+// HttpPostFormResp Http Post 表单请求, 参数为请求地址, 表单, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpPostFormResp(urlStr string, posts map[string]string, r *HttpReq, timeout int) (*HttpResp, error) {
+	return HttpPostFormRespCtx(context.Background(), urlStr, posts, r, timeout)
+}
+
+// HttpPostFormRespCtx Http Post 表单请求, 参数为 context.Context, 请求地址, 表单, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpPostFormRespCtx(ctx context.Context, urlStr string, posts map[string]string, r *HttpReq, timeout int) (*HttpResp, error) {
+	data := url.Values{}
+	for k, v := range posts {
+		data.Set(k, v)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlStr, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", fun.MimePostForm)
+
+	return HttpDoRespCtx(ctx, req, r, timeout)
+}
+
+// HttpPostJson 参数为请求地址 (json string, HttpReq, 超时时间)
+// HttpPostJson(url)、HttpPostJson(url, json)、HttpPostJson(url, timeout)、HttpPostJson(url, json, timeout)、HttpPostJson(url, json, HttpReq)、HttpPostJson(url, json, HttpReq, timeout)
+// 返回 body, 错误信息
+func HttpPostJson(urlStr string, args ...any) ([]byte, error) {
+	json := "{}"
+	if len(args) > 0 {
+		if v, ok := args[0].(string); ok {
+			json = v
+			args = args[1:]
+		}
+	}
+
+	if r, timeout, ok := httpArgs(args); ok {
+		return HttpPostJsonDo(urlStr, json, r, timeout)
+	}
+
+	return nil, ErrHttpParams
+}
+
+// HttpPostJsonDo Http Post Json 请求, 参数为请求地址, json, HttpReq, 超时时间(毫秒)
+// 返回 body, 错误信息
+func HttpPostJsonDo(urlStr string, json string, r *HttpReq, timeout int) ([]byte, error) {
+	resp, err := HttpPostJsonResp(urlStr, json, r, timeout)
+	if err != nil {
+		return nil, err
+	} else {
+		return resp.Body, nil
+	}
+}
+
+// HttpPostJsonResp Http Post Json 请求, 参数为请求地址, json, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpPostJsonResp(urlStr string, json string, r *HttpReq, timeout int) (*HttpResp, error) {
+	return HttpPostJsonRespCtx(context.Background(), urlStr, json, r, timeout)
+}
+
+// HttpPostJsonRespCtx Http Post Json 请求, 参数为 context.Context, 请求地址, json, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpPostJsonRespCtx(ctx context.Context, urlStr string, json string, r *HttpReq, timeout int) (*HttpResp, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlStr, strings.NewReader(json))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", fun.MimeJson)
+
+	return HttpDoRespCtx(ctx, req, r, timeout)
+}
+
+// HttpHead 参数为请求地址 (HttpReq, 超时时间)
+// HttpHead(url)、HttpHead(url, HttpReq)、HttpHead(url, timeout)、HttpHead(url, HttpReq, timeout)
+// HEAD 请求没有响应体, 返回 HttpResp, 错误信息
+func HttpHead(urlStr string, args ...any) (*HttpResp, error) {
+	if r, timeout, ok := httpArgs(args); ok {
+		return HttpHeadResp(urlStr, r, timeout)
+	}
+
+	return nil, ErrHttpParams
+}
+
+// HttpHeadResp Http Head 请求, 参数为请求地址, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpHeadResp(urlStr string, r *HttpReq, timeout int) (*HttpResp, error) {
+	return HttpHeadRespCtx(context.Background(), urlStr, r, timeout)
+}
+
+// HttpHeadRespCtx Http Head 请求, 参数为 context.Context, 请求地址, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpHeadRespCtx(ctx context.Context, urlStr string, r *HttpReq, timeout int) (*HttpResp, error) {
+	return HttpMethodRespCtx(ctx, http.MethodHead, urlStr, nil, r, timeout)
+}
+
+// HttpMethodRespCtx 自定义方法的 Http 请求, 参数为 context.Context, 请求方法, 请求地址, body, HttpReq, 超时时间(毫秒)
+// 返回 HttpResp, 错误信息
+func HttpMethodRespCtx(ctx context.Context, method string, urlStr string, body io.Reader, r *HttpReq, timeout int) (*HttpResp, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return HttpDoRespCtx(ctx, req, r, timeout)
+}
+
+// httpArgs 解析可变参数 (HttpReq, 超时时间)
+// ()、(HttpReq)、(timeout)、(HttpReq, timeout)
+func httpArgs(args []any) (*HttpReq, int, bool) {
+	switch len(args) {
+	case 0:
+		return nil, 0, true
+	case 1:
+		switch v := args[0].(type) {
+		case int:
+			return nil, v, true
+		case *HttpReq:
+			return v, 0, true
+		}
+	case 2:
+		if v, ok := args[0].(*HttpReq); ok {
+			return v, fun.ToInt(args[1]), true
+		}
 	}
 
-	return HttpDoResp(req, r, timeout)
+	return nil, 0, false
 }
 
 // HttpDo Http 请求, 参数为 http.Request, HttpReq, 超时时间(毫秒)
@@ -122,19 +383,43 @@ func HttpDo(req *http.Request, r *HttpReq, timeout int) ([]byte, error) {
 // HttpDoResp Http 请求, 参数为 http.Request, HttpReq, 超时时间(毫秒)
 // 返回 HttpResp, 错误信息
 func HttpDoResp(req *http.Request, r *HttpReq, timeout int) (*HttpResp, error) {
-	// 处理 Transport
+	return HttpDoRespCtx(req.Context(), req, r, timeout)
+}
+
+// HttpDoRespCtx Http 请求, 参数为 context.Context, http.Request, HttpReq, 超时时间(毫秒)
+// context 取消或超时会中断请求, 此时返回 context 的错误
+// 请求依次经过全局中间件和 HttpReq.Middlewares
+// 返回 HttpResp, 错误信息
+func HttpDoRespCtx(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpResp, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if req.Context() != ctx {
+		req = req.WithContext(ctx)
+	}
 	if r == nil {
-		r = &HttpReq{
-			HttpReq: &fun.HttpReq{
-				Transport: HttpDefaultTransport,
-			},
-		}
-	} else if r.HttpReq == nil {
-		r.HttpReq = &fun.HttpReq{
-			Transport: HttpDefaultTransport,
-		}
-	} else if r.Transport == nil {
-		r.Transport = HttpDefaultTransport
+		r = &HttpReq{}
+	}
+
+	return chainMiddleware(httpDoResp, r)(ctx, req, r, timeout)
+}
+
+// httpDoResp 发送 Http 请求, 中间件链的最内层
+func httpDoResp(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpResp, error) {
+	// 请求耗时和网络信息
+	var trace *HttpTrace
+	if r.Trace {
+		trace, ctx = newHttpTrace(ctx)
+		defer trace.done()
+	}
+	if req.Context() != ctx {
+		req = req.WithContext(ctx)
+	}
+
+	// 处理 Transport, 未指定时根据 TransportProfile 选择
+	transport := r.transport()
+	if r.HttpReq == nil {
+		r.HttpReq = &fun.HttpReq{}
 	}
 
 	// 强制文本类型
@@ -146,28 +431,325 @@ func HttpDoResp(req *http.Request, r *HttpReq, timeout int) (*HttpResp, error) {
 	var charset CharsetRes
 	httpResp := &HttpResp{
 		Charset: charset,
+		Trace:   trace,
 	}
 
-	resp, err := fun.HttpDoResp(req, r.HttpReq, timeout)
+	// 主机限速
+	if limiter := r.limiter(); limiter != nil {
+		release, err := limiter.Wait(ctx, req.URL.Hostname())
+		if err != nil {
+			httpResp.HttpResp = &fun.HttpResp{}
+			return httpResp, err
+		}
+		defer release()
+	}
+
+	// TLS 配置
+	if r.TLS != nil {
+		var err error
+		if transport, err = r.TLS.transport(transport); err != nil {
+			httpResp.HttpResp = &fun.HttpResp{}
+			return httpResp, err
+		}
+	}
+
+	// 代理池
+	var proxy *url.URL
+	if r.Proxy != nil {
+		var err error
+		if proxy, err = r.Proxy.Select(req.URL.Hostname()); err != nil {
+			httpResp.HttpResp = &fun.HttpResp{}
+			return httpResp, err
+		}
+		if transport, err = r.Proxy.transport(transport, proxy); err != nil {
+			httpResp.HttpResp = &fun.HttpResp{}
+			return httpResp, err
+		}
+		httpResp.Proxy = proxy.Redacted()
+	}
+
+	// 响应缓存, 存在缓存时发送条件请求
+	var cacheKeyStr string
+	var cached *CacheEntry
+	if r.Cache != nil {
+		if cacheKeyStr = cacheKey(req); cacheKeyStr != "" {
+			if entry, exists := r.Cache.Get(cacheKeyStr); exists {
+				cached = entry
+				req = req.Clone(ctx)
+				cacheRequest(req, entry)
+			}
+		}
+	}
+
+	// 记录响应信息, httpDo 在请求失败时不返回响应头
+	recorder := &roundTripRecorder{transport: transport, trace: trace}
+
+	resp, err := httpDo(req, r.HttpReq, recorder, timeout)
 	httpResp.HttpResp = resp
+	httpResp.Redirects = recorder.redirects
 	if err != nil {
-		return httpResp, err
+		// httpDo 不返回 context 的错误, 这里还原
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return httpResp, ctxErr
+		}
+
+		// 证书校验失败
+		if tlsVerifyError(recorder.err) {
+			httpResp.TLSVerify = TLSError
+			return httpResp, withCause(ErrTLSVerify, recorder.err)
+		}
+
+		// 304 命中缓存
+		if cached != nil && resp != nil && resp.StatusCode == http.StatusNotModified {
+			httpResp.HttpResp = cacheResp(cached, req.URL)
+			httpResp.FromCache = true
+		} else {
+			err = httpError(httpResp, err, recorder.header)
+			// 连接失败、超时等记录为代理失败
+			if proxy != nil && errors.Is(err, ErrDo) {
+				r.Proxy.MarkFailure(proxy)
+			}
+			return httpResp, err
+		}
+	} else {
+		// httpDo 只解压 gzip、deflate
+		if err := httpRespDecode(httpResp, r.MaxContentLength); err != nil {
+			return httpResp, err
+		}
+
+		if cacheKeyStr != "" {
+			if entry := cacheEntry(resp); entry != nil {
+				r.Cache.Set(cacheKeyStr, entry)
+			} else if resp.Success {
+				// 资源不再提供校验信息或禁止缓存, 删除旧的缓存
+				r.Cache.Delete(cacheKeyStr)
+			}
+		}
+	}
+	if proxy != nil {
+		r.Proxy.MarkSuccess(proxy)
 	}
 
+	httpResp.TLS = recorder.tls
+	httpResp.TLSVerify = tlsVerifyResult(recorder.tls)
+
 	// 默认会自动进行探测编码和转码, 除非手动禁用
 	if r == nil || !r.DisableCharset {
-		charsetRes := Charset(httpResp.Body, httpResp.Headers)
-		httpResp.Charset = charsetRes
-
-		if charsetRes.Charset != "" && charsetRes.Charset != "UTF-8" {
-			utf8Body, e := fun.ToUtf8(httpResp.Body, charsetRes.Charset)
-			if e != nil {
-				return httpResp, errors.New("ErrorCharset")
-			} else {
-				httpResp.Body = utf8Body
+		if err := httpRespCharset(httpResp); err != nil {
+			return httpResp, err
+		}
+	}
+
+	return httpResp, nil
+}
+
+// httpSend 创建 http.Client 并发送请求, 普通请求和流式请求共用
+// 客户端、跳转和请求头的处理与 fun.HttpDoResp 一致, 不修改 HttpReq.Headers
+func httpSend(req *http.Request, r *fun.HttpReq, transport http.RoundTripper, timeout int) (*http.Response, error) {
+	if timeout == 0 {
+		timeout = fun.HttpDefaultTimeOut
+	}
+
+	client := &http.Client{
+		Timeout:   time.Duration(timeout) * time.Millisecond,
+		Transport: transport,
+		Jar:       r.Jar,
+	}
+
+	// Redirect 策略
+	if r.DisableRedirect {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	} else if r.MaxRedirect > 0 && r.MaxRedirect < 10 {
+		maxRedirect := r.MaxRedirect
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirect {
+				return http.ErrUseLastResponse
 			}
+			return nil
 		}
 	}
 
+	// 请求头, 未指定 Accept-Encoding 时使用 HttpDefaultAcceptEncoding
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+	if r.UserAgent != "" {
+		req.Header.Set("User-Agent", r.UserAgent)
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", fun.HttpDefaultUserAgent)
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", HttpDefaultAcceptEncoding)
+	}
+
+	return client.Do(req)
+}
+
+// httpDo 发送请求并读取响应体, 错误与 fun.HttpDoResp 一致, 由 httpError 转换
+// 只解压 gzip、deflate, 其他压缩由 httpRespDecode 处理
+func httpDo(req *http.Request, r *fun.HttpReq, transport http.RoundTripper, timeout int) (*fun.HttpResp, error) {
+	httpResp := &fun.HttpResp{}
+
+	resp, err := httpSend(req, r, transport, timeout)
+	if err != nil {
+		return httpResp, ErrDo
+	}
+	defer resp.Body.Close()
+
+	// 响应
+	httpResp.StatusCode = resp.StatusCode
+	httpResp.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !httpResp.Success && !r.ReadBodyWithFail {
+		return httpResp, ErrStatusCode
+	}
+
+	httpResp.Headers = &resp.Header
+	httpResp.ContentLength = resp.ContentLength
+	httpResp.RequestURL = resp.Request.URL
+
+	encoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	if encoding != "gzip" && encoding != "deflate" {
+		encoding = ""
+	}
+	reader, err := decodeReader(encoding, resp.Body)
+	if err != nil {
+		return httpResp, ErrGzip
+	}
+	defer reader.Close()
+
+	// ContentType 限制
+	if !httpAllowContentType(r, resp.Header) {
+		return httpResp, ErrContentType
+	}
+
+	// ContentLength 限制, 未知长度时只读取到最大长度
+	var body []byte
+	if r.MaxContentLength > 0 && resp.ContentLength != -1 {
+		if resp.ContentLength > r.MaxContentLength {
+			return httpResp, ErrContentLength
+		}
+		body, err = io.ReadAll(reader)
+	} else if r.MaxContentLength > 0 {
+		body, err = io.ReadAll(io.LimitReader(reader, r.MaxContentLength))
+		if err == nil && int64(len(body)) >= r.MaxContentLength {
+			return httpResp, ErrContentLength
+		}
+	} else {
+		body, err = io.ReadAll(reader)
+	}
+	if err != nil {
+		return httpResp, ErrReadBody
+	}
+	httpResp.Body = body
+
+	if !httpResp.Success {
+		return httpResp, ErrStatusCode
+	}
+
 	return httpResp, nil
 }
+
+// httpAllowContentType 判断响应的 Content-Type 是否在 HttpReq.AllowedContentTypes 中, 前缀匹配
+func httpAllowContentType(r *fun.HttpReq, headers http.Header) bool {
+	if len(r.AllowedContentTypes) == 0 {
+		return true
+	}
+
+	ct := strings.TrimSpace(strings.ToLower(headers.Get("Content-Type")))
+	for _, t := range r.AllowedContentTypes {
+		if strings.HasPrefix(ct, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// roundTripRecorder 记录请求过程中的响应信息
+type roundTripRecorder struct {
+	transport http.RoundTripper
+
+	// 最后一次响应头
+	header http.Header
+
+	// 最后一次响应的 TLS 连接状态
+	tls *tls.ConnectionState
+
+	// 最后一次请求错误
+	err error
+
+	// HTTP 跳转链
+	redirects []HttpRedirect
+
+	// 最后一次跳转响应, 发起下一次请求时才加入跳转链, 没有跟随的跳转(超过 MaxRedirect 或禁止跳转)不记录
+	pending *HttpRedirect
+
+	// 请求耗时和网络信息, 不为空时记录请求链
+	trace *HttpTrace
+}
+
+func (t *roundTripRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.pending != nil {
+		t.redirects = append(t.redirects, *t.pending)
+		t.pending = nil
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if t.trace != nil {
+		t.trace.roundTrip(req, resp)
+	}
+	if resp != nil {
+		t.header = resp.Header
+		t.tls = resp.TLS
+		if redirect, ok := newHttpRedirect(req, resp); ok {
+			t.pending = &redirect
+		}
+	}
+	t.err = err
+
+	return resp, err
+}
+
+// httpRespCharset 探测 HttpResp 的编码并将 Body 转换为 UTF-8
+func httpRespCharset(httpResp *HttpResp) error {
+	utf8Body, charsetRes, err := charsetToUtf8(httpResp.Body, httpResp.Headers)
+	httpResp.Charset = charsetRes
+	if err != nil {
+		return err
+	}
+
+	httpResp.Body = utf8Body
+
+	return nil
+}
+
+// charsetToUtf8 探测编码并将 body 转换为 UTF-8
+func charsetToUtf8(body []byte, headers *http.Header) ([]byte, CharsetRes, error) {
+	charsetRes := Charset(body, headers)
+
+	// 转换前去掉 BOM
+	if charsetRes.CharsetPos == CharsetPosBom {
+		_, n := CharsetFromBom(body)
+		body = body[n:]
+	}
+
+	// 修复混合编码
+	if charsetRes.CharsetPos == CharsetPosRepair {
+		utf8Body, _ := CharsetRepair(body, charsetRes.Candidates)
+		return utf8Body, charsetRes, nil
+	}
+
+	if charsetRes.Charset != "" && charsetRes.Charset != "UTF-8" {
+		utf8Body, e := charsetDecode(body, charsetRes.Charset)
+		if e != nil {
+			return body, charsetRes, ErrCharset
+		} else {
+			return utf8Body, charsetRes, nil
+		}
+	}
+
+	return body, charsetRes, nil
+}
@@ -2,13 +2,24 @@ package spider
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/x-funs/go-fun"
 )
 
 func TestHttpGetCharsetLang(t *testing.T) {
+	skipOnline(t)
+
 	var urlStrs = []string{
 		// "http://suosi.com.cn",
 		// "https://www.163.com",
@@ -55,6 +66,8 @@ func TestHttpGetCharsetLang(t *testing.T) {
 }
 
 func TestHttpGetCharsetLangURL(t *testing.T) {
+	skipOnline(t)
+
 	var urlStrs = []string{
 		"https://marriott.co.kr",
 	}
@@ -82,6 +95,8 @@ func TestHttpGetCharsetLangURL(t *testing.T) {
 }
 
 func TestHttpGet(t *testing.T) {
+	skipOnline(t)
+
 	var urlStr string
 
 	urlStr = "http://www.niuchaoqun.com"
@@ -105,6 +120,8 @@ func TestHttpGet(t *testing.T) {
 }
 
 func TestHttpGetContentType(t *testing.T) {
+	skipOnline(t)
+
 	var urlStr string
 
 	urlStr = "https://mirrors.163.com/mysql/Downloads/MySQL-8.0/libmysqlclient-dev_8.0.27-1debian10_amd64.deb"
@@ -130,6 +147,8 @@ func TestHttpGetContentType(t *testing.T) {
 }
 
 func TestHttpGetContentLength(t *testing.T) {
+	skipOnline(t)
+
 	var urlStr string
 
 	urlStr = "http://suosi.com.cn"
@@ -155,3 +174,182 @@ func TestHttpGetContentLength(t *testing.T) {
 
 	t.Log(fun.String(resp.Body))
 }
+
+func TestHttpGetRespCtx(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := HttpGetRespCtx(ctx, ts.URL, nil, 10000)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func newTestConnServer(conns *int32) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>" + r.Proto + "</body></html>"))
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(conns, 1)
+		}
+	}
+
+	return ts
+}
+
+func TestHttpTransportProfile(t *testing.T) {
+	var conns int32
+	ts := newTestConnServer(&conns)
+	ts.Start()
+	defer ts.Close()
+
+	for _, c := range []struct {
+		profile TransportProfile
+		want    int32
+	}{{TransportDefault, 5}, {TransportPooled, 1}} {
+		atomic.StoreInt32(&conns, 0)
+		for i := 0; i < 5; i++ {
+			if _, err := HttpGetResp(ts.URL, &HttpReq{TransportProfile: c.profile}, 5000); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := atomic.LoadInt32(&conns); got != c.want {
+			t.Errorf("profile %d want %d connections, got %d", c.profile, c.want, got)
+		}
+	}
+}
+
+func TestHttpPooledTransportHTTP2(t *testing.T) {
+	var conns int32
+	ts := newTestConnServer(&conns)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	resp, err := HttpGetResp(ts.URL, &HttpReq{TransportProfile: TransportPooled}, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(resp.Body, []byte("HTTP/2.0")) {
+		t.Errorf("want HTTP/2.0, got %s", resp.Body)
+	}
+}
+
+func benchmarkHttpTransportProfile(b *testing.B, profile TransportProfile) {
+	var conns int32
+	ts := newTestConnServer(&conns)
+	ts.Start()
+	defer ts.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := HttpGetResp(ts.URL, &HttpReq{TransportProfile: profile}, 5000); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt32(&conns))/float64(b.N), "conns/op")
+}
+
+func BenchmarkHttpGetRespDefaultTransport(b *testing.B) {
+	benchmarkHttpTransportProfile(b, TransportDefault)
+}
+
+func BenchmarkHttpGetRespPooledTransport(b *testing.B) {
+	benchmarkHttpTransportProfile(b, TransportPooled)
+}
+
+// newTestSessionServer 首页设置 Cookie, 其他页面没有 Cookie 时返回 403, 作为 HTTP 代理使用时可以模拟任意域名
+func newTestSessionServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "", "/":
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "abc", Path: "/"})
+			_, _ = w.Write([]byte(testHomeHtml()))
+		case "/news/2022/0901/1001.html":
+			if c, err := r.Cookie("token"); err != nil || c.Value != "abc" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(testArticleHtml()))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestHttpGetRespCookieJar(t *testing.T) {
+	ts := newTestSessionServer()
+	defer ts.Close()
+
+	articleUrl := ts.URL + "/news/2022/0901/1001.html"
+	if _, err := HttpGetResp(articleUrl, nil, 5000); !errors.Is(err, ErrStatusCode) {
+		t.Fatalf("want ErrStatusCode without cookie, got %v", err)
+	}
+
+	req := &HttpReq{HttpReq: &fun.HttpReq{Jar: NewCookieJar()}}
+	if _, err := HttpGetResp(ts.URL, req, 5000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HttpGetResp(articleUrl, req, 5000); err != nil {
+		t.Fatalf("want article with cookie, got %v", err)
+	}
+}
+
+func TestHttpPostHead(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/image" {
+			w.Header().Set("Content-Type", "image/png")
+			return
+		}
+		// GBK 响应
+		w.Header().Set("Content-Type", "text/html; charset=gbk")
+		w.Header().Set("X-Method", r.Method)
+		gbk, _ := fun.Utf8To([]byte("<html><body>中国 "+r.Method+" "+r.Header.Get("Content-Type")+" "+string(body)+"</body></html>"), "gbk")
+		_, _ = w.Write(gbk)
+	}))
+	defer ts.Close()
+
+	body, err := HttpPost(ts.URL, strings.NewReader("a=1"), 5000)
+	if err != nil || string(body) != "<html><body>中国 POST  a=1</body></html>" {
+		t.Errorf("unexpected post %s %v", body, err)
+	}
+
+	body, err = HttpPostForm(ts.URL, map[string]string{"page": "2"})
+	if err != nil || string(body) != "<html><body>中国 POST application/x-www-form-urlencoded page=2</body></html>" {
+		t.Errorf("unexpected post form %s %v", body, err)
+	}
+
+	resp, err := HttpPostJsonResp(ts.URL, `{"page":2}`, nil, 5000)
+	if err != nil || string(resp.Body) != `<html><body>中国 POST application/json {"page":2}</body></html>` {
+		t.Errorf("unexpected post json %s %v", resp.Body, err)
+	}
+	if resp.Charset.Charset != "GBK" {
+		t.Errorf("want charset GBK, got %s", resp.Charset.Charset)
+	}
+
+	resp, err = HttpHead(ts.URL, 5000)
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Headers.Get("X-Method") != http.MethodHead || len(resp.Body) != 0 {
+		t.Errorf("unexpected head %+v %v", resp, err)
+	}
+
+	// 与 HttpGet 一样限制 ContentType
+	if _, err := HttpPostJsonResp(ts.URL+"/image", "{}", &HttpReq{ForceTextContentType: true}, 5000); err == nil {
+		t.Errorf("want content type error")
+	}
+
+	if _, err := HttpPost(ts.URL, "a=1"); !errors.Is(err, ErrHttpParams) {
+		t.Errorf("want ErrHttpParams, got %v", err)
+	}
+}
@@ -25,16 +25,23 @@ const (
 
 var (
 	CharsetLangMap = map[string]string{
-		"GBK":         "zh",
-		"Big5":        "zh",
-		"ISO-2022-CN": "zh",
-		"SHIFT_JIS":   "ja",
-		"KOI8-R":      "ru",
-		"EUC-JP":      "ja",
-		"EUC-KR":      "ko",
-		"EUC-CN":      "zh",
-		"ISO-2022-JP": "ja",
-		"ISO-2022-KR": "ko",
+		"GBK":          "zh",
+		"Big5":         "zh",
+		"ISO-2022-CN":  "zh",
+		"SHIFT_JIS":    "ja",
+		"KOI8-R":       "ru",
+		"EUC-JP":       "ja",
+		"EUC-KR":       "ko",
+		"EUC-CN":       "zh",
+		"ISO-2022-JP":  "ja",
+		"ISO-2022-KR":  "ko",
+		"GB18030":      "zh",
+		"WINDOWS-874":  "th",
+		"WINDOWS-1258": "vi",
+		"ISO-8859-7":   "el",
+		"WINDOWS-1253": "el",
+		"ISO-8859-8":   "he",
+		"ISO-8859-8-I": "he",
 	}
 
 	LangEnZhMap = map[string]string{
@@ -53,6 +60,8 @@ var (
 		"th": "泰语",
 		"vi": "越南语",
 		"my": "缅甸语",
+		"el": "希腊语",
+		"he": "希伯来语",
 	}
 
 	LangZhEnMap = map[string]string{
@@ -71,6 +80,8 @@ var (
 		"泰语":   "th",
 		"越南语":  "vi",
 		"缅甸语":  "my",
+		"希腊语":  "el",
+		"希伯来语": "he",
 	}
 
 	langMetaSelectors = []string{
@@ -131,6 +142,7 @@ func Lang(doc *goquery.Document, charset string, listMode bool) LangRes {
 
 	// 如果存在特定语言的 charset 对照表, 则直接返回
 	if charset != "" {
+		charset = convertCharset(charset)
 		if _, exist := CharsetLangMap[charset]; exist {
 			res.Lang = CharsetLangMap[charset]
 			res.LangPos = LangPosCharset
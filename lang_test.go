@@ -55,6 +55,7 @@ func BenchmarkLinguaTest(b *testing.B) {
 }
 
 func TestLang(t *testing.T) {
+	skipOnline(t)
 
 	var urlStrs = []string{
 
@@ -0,0 +1,89 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/x-funs/go-fun"
+)
+
+// HttpHandler 发送 Http 请求并返回 HttpResp
+type HttpHandler func(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpResp, error)
+
+// Middleware Http 请求中间件, 包装下一个 HttpHandler
+// 可以修改请求、记录耗时和指标、不发送请求直接返回响应或拒绝请求
+type Middleware func(next HttpHandler) HttpHandler
+
+var (
+	middlewareMu sync.RWMutex
+
+	// 全局中间件
+	middlewares []Middleware
+)
+
+// UseMiddleware 注册全局中间件, 对所有 HttpDoRespCtx、HttpDoStreamCtx 请求生效
+// 全局中间件在 HttpReq.Middlewares 外层, 先注册的在外层
+func UseMiddleware(mw ...Middleware) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+
+	middlewares = append(middlewares, mw...)
+}
+
+// ResetMiddleware 清空全局中间件
+func ResetMiddleware() {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+
+	middlewares = nil
+}
+
+// BeforeRequest 请求前调用 fn 的中间件, fn 可以修改请求
+// fn 返回的 HttpResp 不为空时不发送请求, 直接返回该响应
+// fn 返回错误时拒绝请求, 返回的错误满足 errors.Is(err, ErrRequestVetoed)
+func BeforeRequest(fn func(ctx context.Context, req *http.Request, r *HttpReq) (*HttpResp, error)) Middleware {
+	return func(next HttpHandler) HttpHandler {
+		return func(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpResp, error) {
+			resp, err := fn(ctx, req, r)
+			if err != nil {
+				if !errors.Is(err, ErrRequestVetoed) {
+					err = withCause(ErrRequestVetoed, err)
+				}
+				return &HttpResp{HttpResp: &fun.HttpResp{}}, err
+			}
+			if resp != nil {
+				return resp, nil
+			}
+
+			return next(ctx, req, r, timeout)
+		}
+	}
+}
+
+// AfterResponse 响应后调用 fn 的中间件, 请求失败时也会调用, fn 可以修改响应和错误
+func AfterResponse(fn func(ctx context.Context, req *http.Request, resp *HttpResp, err error) (*HttpResp, error)) Middleware {
+	return func(next HttpHandler) HttpHandler {
+		return func(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpResp, error) {
+			resp, err := next(ctx, req, r, timeout)
+
+			return fn(ctx, req, resp, err)
+		}
+	}
+}
+
+// chainMiddleware 按全局中间件、HttpReq.Middlewares 的顺序由外到内包装 HttpHandler
+func chainMiddleware(h HttpHandler, r *HttpReq) HttpHandler {
+	middlewareMu.RLock()
+	chain := make([]Middleware, 0, len(middlewares)+len(r.Middlewares))
+	chain = append(chain, middlewares...)
+	middlewareMu.RUnlock()
+	chain = append(chain, r.Middlewares...)
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+
+	return h
+}
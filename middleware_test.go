@@ -0,0 +1,142 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/x-funs/go-fun"
+)
+
+func TestHttpGetRespMiddleware(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>" + r.Header.Get("Authorization") + "</body></html>"))
+	}))
+	defer ts.Close()
+
+	var order []string
+	var elapsed time.Duration
+	var status int
+	req := &HttpReq{Middlewares: []Middleware{
+		BeforeRequest(func(ctx context.Context, req *http.Request, r *HttpReq) (*HttpResp, error) {
+			order = append(order, "auth")
+			req.Header.Set("Authorization", "Bearer token")
+			return nil, nil
+		}),
+		func(next HttpHandler) HttpHandler {
+			return func(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpResp, error) {
+				start := time.Now()
+				resp, err := next(ctx, req, r, timeout)
+				elapsed = time.Since(start)
+				return resp, err
+			}
+		},
+		AfterResponse(func(ctx context.Context, req *http.Request, resp *HttpResp, err error) (*HttpResp, error) {
+			status = resp.StatusCode
+			return resp, err
+		}),
+	}}
+
+	UseMiddleware(BeforeRequest(func(ctx context.Context, req *http.Request, r *HttpReq) (*HttpResp, error) {
+		order = append(order, "global")
+		return nil, nil
+	}))
+	defer ResetMiddleware()
+
+	resp, err := HttpGetResp(ts.URL, req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "<html><body>Bearer token</body></html>" || status != http.StatusOK || elapsed <= 0 {
+		t.Errorf("unexpected body %s status %d elapsed %v", resp.Body, status, elapsed)
+	}
+	if strings.Join(order, ",") != "global,auth" {
+		t.Errorf("want global,auth, got %v", order)
+	}
+	ResetMiddleware()
+
+	// 直接返回响应
+	req = &HttpReq{Middlewares: []Middleware{BeforeRequest(func(ctx context.Context, req *http.Request, r *HttpReq) (*HttpResp, error) {
+		return &HttpResp{HttpResp: &fun.HttpResp{Success: true, StatusCode: http.StatusOK, Body: []byte("cached")}}, nil
+	})}}
+	resp, err = HttpGetResp(ts.URL, req, 5000)
+	if err != nil || string(resp.Body) != "cached" {
+		t.Errorf("want synthetic response, got %s %v", resp.Body, err)
+	}
+
+	// 拒绝请求
+	req = &HttpReq{Middlewares: []Middleware{BeforeRequest(func(ctx context.Context, req *http.Request, r *HttpReq) (*HttpResp, error) {
+		return nil, errors.New("blocked")
+	})}}
+	if _, err := HttpGetResp(ts.URL, req, 5000); !errors.Is(err, ErrRequestVetoed) {
+		t.Errorf("want ErrRequestVetoed, got %v", err)
+	}
+	if _, err := GetLinkDataWithReq(ts.URL, true, req, 5000, 3); !errors.Is(err, ErrRequestVetoed) {
+		t.Errorf("want ErrRequestVetoed from GetLinkData, got %v", err)
+	}
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("want 1 request sent, got %d", got)
+	}
+}
+
+func TestHttpGetStreamMiddleware(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>" + r.Header.Get("Authorization") + "</body></html>"))
+	}))
+	defer ts.Close()
+
+	var status int
+	UseMiddleware(BeforeRequest(func(ctx context.Context, req *http.Request, r *HttpReq) (*HttpResp, error) {
+		req.Header.Set("Authorization", "Bearer token")
+		return nil, nil
+	}))
+	defer ResetMiddleware()
+
+	req := &HttpReq{Middlewares: []Middleware{AfterResponse(func(ctx context.Context, req *http.Request, resp *HttpResp, err error) (*HttpResp, error) {
+		status = resp.StatusCode
+		return resp, err
+	})}}
+	stream, err := HttpGetStream(ts.URL, req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(stream)
+	_ = stream.Close()
+	if string(body) != "<html><body>Bearer token</body></html>" || status != http.StatusOK {
+		t.Errorf("unexpected body %s status %d", body, status)
+	}
+	ResetMiddleware()
+
+	// 直接返回响应
+	req = &HttpReq{Middlewares: []Middleware{BeforeRequest(func(ctx context.Context, req *http.Request, r *HttpReq) (*HttpResp, error) {
+		return &HttpResp{HttpResp: &fun.HttpResp{Success: true, StatusCode: http.StatusOK, Body: []byte("cached")}}, nil
+	})}}
+	stream, err = HttpGetStream(ts.URL, req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(stream)
+	_ = stream.Close()
+	if string(body) != "cached" || stream.StatusCode != http.StatusOK {
+		t.Errorf("want synthetic response, got %s", body)
+	}
+
+	// 拒绝请求
+	req = &HttpReq{Middlewares: []Middleware{BeforeRequest(func(ctx context.Context, req *http.Request, r *HttpReq) (*HttpResp, error) {
+		return nil, errors.New("blocked")
+	})}}
+	if _, err := HttpGetStream(ts.URL, req, 5000); !errors.Is(err, ErrRequestVetoed) {
+		t.Errorf("want ErrRequestVetoed, got %v", err)
+	}
+}
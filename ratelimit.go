@@ -0,0 +1,314 @@
+package spider
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/suosi-inc/go-pkg-spider/extract"
+)
+
+// HostLimit 单个主机的请求限制
+type HostLimit struct {
+	// 每秒请求数, <= 0 时不限制速率
+	Rate float64
+
+	// 突发请求数, <= 0 时为 1
+	Burst int
+
+	// 最大并发请求数, <= 0 时不限制并发
+	MaxInFlight int
+}
+
+// DefaultNewsSpiderHostLimit NewsSpider 默认使用的主机请求限制
+var DefaultNewsSpiderHostLimit = HostLimit{
+	Rate:        2,
+	Burst:       2,
+	MaxInFlight: 4,
+}
+
+// hostLimiterSweepSize 主机状态数量达到该值时清理空闲的主机状态
+const hostLimiterSweepSize = 1024
+
+// DefaultHostLimiter 默认全局使用的主机限速器, 为空时不限制, HttpReq.Limiter 优先
+var DefaultHostLimiter *HostLimiter
+
+// HostLimiter 按主机(hostname)限制请求速率(令牌桶)和并发数, 可按域名单独配置
+type HostLimiter struct {
+	mu sync.Mutex
+
+	// 默认限制
+	limit HostLimit
+
+	// 按域名配置的限制, key 为主机名或主域名
+	limits map[string]HostLimit
+
+	// 主机状态, 没有请求且令牌桶已满的主机会被清理
+	hosts map[string]*hostState
+
+	// 下次清理空闲主机状态时的数量
+	sweepAt int
+}
+
+type hostState struct {
+	limit  HostLimit
+	tokens float64
+	last   time.Time
+
+	// 请求中的数量
+	inFlight int
+
+	// 并发已满时等待的通知, 请求结束或限制变更时关闭
+	wake chan struct{}
+
+	// 等待中和请求中的数量
+	waiters int
+}
+
+// NewHostLimiter 初始化主机限速器, 参数为默认限制
+func NewHostLimiter(limit HostLimit) *HostLimiter {
+	return &HostLimiter{
+		limit:  limit,
+		limits: make(map[string]HostLimit),
+		hosts:  make(map[string]*hostState),
+	}
+}
+
+// SetLimit 设置域名的请求限制, domain 为主机名(如 news.163.com)或主域名(如 163.com, 对所有子域名生效)
+func (l *HostLimiter) SetLimit(domain string, limit HostLimit) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits[domain] = limit
+
+	// 更新受影响的主机状态, 请求中的状态不能删除, 否则并发数会超出限制
+	now := time.Now()
+	for host, s := range l.hosts {
+		if host == domain || extract.DomainTop(host) == domain {
+			s.setLimit(l.limitFor(host), now)
+		}
+	}
+}
+
+// Limit 返回主机的请求限制, 主机名配置优先于主域名配置
+func (l *HostLimiter) Limit(host string) HostLimit {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limitFor(host)
+}
+
+func (l *HostLimiter) limitFor(host string) HostLimit {
+	if limit, exists := l.limits[host]; exists {
+		return limit
+	}
+	if limit, exists := l.limits[extract.DomainTop(host)]; exists {
+		return limit
+	}
+
+	return l.limit
+}
+
+// state 返回主机状态, 不存在时初始化
+func (l *HostLimiter) state(host string) *hostState {
+	s, exists := l.hosts[host]
+	if !exists {
+		if len(l.hosts) >= l.sweepAt {
+			l.sweep(time.Now())
+		}
+
+		limit := l.limitFor(host)
+		s = &hostState{
+			limit:  limit,
+			tokens: float64(burst(limit)),
+			last:   time.Now(),
+		}
+		l.hosts[host] = s
+	}
+
+	return s
+}
+
+// Wait 等待主机的请求许可, 返回的 release 必须在请求结束后调用以释放并发数
+func (l *HostLimiter) Wait(ctx context.Context, host string) (func(), error) {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	s := l.state(host)
+	s.waiters++
+	l.mu.Unlock()
+
+	acquired := false
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.release(host, s, acquired)
+		})
+	}
+
+	// 并发限制
+	if err := l.acquire(ctx, s); err != nil {
+		release()
+		return func() {}, err
+	}
+	acquired = true
+
+	// 速率限制, 预留令牌后等待
+	wait := l.reserve(s)
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.cancel(s)
+			release()
+			return func() {}, ctx.Err()
+		}
+	}
+
+	return release, nil
+}
+
+// acquire 等待并发许可, 限制变更后按新的 MaxInFlight 判断
+func (l *HostLimiter) acquire(ctx context.Context, s *hostState) error {
+	for {
+		l.mu.Lock()
+		if s.limit.MaxInFlight <= 0 || s.inFlight < s.limit.MaxInFlight {
+			s.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		if s.wake == nil {
+			s.wake = make(chan struct{})
+		}
+		wake := s.wake
+		l.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve 预留一个令牌, 返回需要等待的时间
+func (l *HostLimiter) reserve(s *hostState) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s.limit.Rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.limit.Rate
+	if maxTokens := float64(burst(s.limit)); s.tokens > maxTokens {
+		s.tokens = maxTokens
+	}
+	s.last = now
+
+	s.tokens--
+	if s.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-s.tokens / s.limit.Rate * float64(time.Second))
+}
+
+// cancel 归还预留的令牌
+func (l *HostLimiter) cancel(s *hostState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s.tokens++
+}
+
+// release 请求结束, 主机没有其他请求且令牌桶已满时清理主机状态
+func (l *HostLimiter) release(host string, s *hostState, acquired bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s.waiters--
+	if acquired {
+		s.inFlight--
+		s.notify()
+	}
+	if s.idle(time.Now()) && l.hosts[host] == s {
+		delete(l.hosts, host)
+	}
+}
+
+// sweep 清理空闲的主机状态, 需要持有锁
+func (l *HostLimiter) sweep(now time.Time) {
+	for host, s := range l.hosts {
+		if s.idle(now) {
+			delete(l.hosts, host)
+		}
+	}
+
+	l.sweepAt = 2 * len(l.hosts)
+	if l.sweepAt < hostLimiterSweepSize {
+		l.sweepAt = hostLimiterSweepSize
+	}
+}
+
+// setLimit 更新限制, 令牌按原速率累计到当前时间后按新的 Burst 截断, 需要持有锁
+func (s *hostState) setLimit(limit HostLimit, now time.Time) {
+	if s.limit.Rate > 0 {
+		s.tokens += now.Sub(s.last).Seconds() * s.limit.Rate
+	} else {
+		s.tokens = float64(burst(limit))
+	}
+	if maxTokens := float64(burst(limit)); s.tokens > maxTokens {
+		s.tokens = maxTokens
+	}
+	s.last = now
+	s.limit = limit
+
+	// 等待并发许可的请求按新的限制重新判断
+	s.notify()
+}
+
+// notify 唤醒等待并发许可的请求, 需要持有锁
+func (s *hostState) notify() {
+	if s.wake != nil {
+		close(s.wake)
+		s.wake = nil
+	}
+}
+
+// idle 没有请求且令牌桶已满, 清理后重新初始化的状态与当前一致
+func (s *hostState) idle(now time.Time) bool {
+	if s.waiters > 0 {
+		return false
+	}
+	if s.limit.Rate <= 0 {
+		return true
+	}
+
+	return s.tokens+now.Sub(s.last).Seconds()*s.limit.Rate >= float64(burst(s.limit))
+}
+
+func burst(limit HostLimit) int {
+	if limit.Burst <= 0 {
+		return 1
+	}
+
+	return limit.Burst
+}
+
+// limiter 返回 HttpReq 使用的主机限速器, 未指定时返回 DefaultHostLimiter
+func (r *HttpReq) limiter() *HostLimiter {
+	if r != nil && r.Limiter != nil {
+		return r.Limiter
+	}
+
+	return DefaultHostLimiter
+}
@@ -0,0 +1,248 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/x-funs/go-fun"
+)
+
+func TestHostLimiterRate(t *testing.T) {
+	l := NewHostLimiter(HostLimit{Rate: 20, Burst: 2})
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		release, err := l.Wait(context.Background(), "www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+
+	// 突发 2 个, 剩余 4 个按 20/s 需要约 200ms
+	if spend := time.Since(start); spend < 150*time.Millisecond {
+		t.Errorf("rate limit not applied, spend %v", spend)
+	}
+
+	// 其他主机不受影响
+	start = time.Now()
+	release, _ := l.Wait(context.Background(), "news.example.org")
+	release()
+	if spend := time.Since(start); spend > 20*time.Millisecond {
+		t.Errorf("other host should not wait, spend %v", spend)
+	}
+}
+
+func TestHostLimiterMaxInFlight(t *testing.T) {
+	l := NewHostLimiter(HostLimit{MaxInFlight: 2})
+
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Wait(context.Background(), "www.example.com")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("want max in flight 2, got %d", peak)
+	}
+}
+
+func TestHostLimiterSetLimit(t *testing.T) {
+	l := NewHostLimiter(HostLimit{Rate: 1})
+	l.SetLimit("example.com", HostLimit{Rate: 5, MaxInFlight: 1})
+	l.SetLimit("news.example.com", HostLimit{Rate: 10})
+
+	cases := map[string]float64{
+		"www.example.com":  5,
+		"news.example.com": 10,
+		"www.example.org":  1,
+	}
+	for host, want := range cases {
+		if got := l.Limit(host).Rate; got != want {
+			t.Errorf("Limit(%s).Rate = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestHostLimiterSetLimitInFlight(t *testing.T) {
+	l := NewHostLimiter(HostLimit{MaxInFlight: 2})
+	wait := func() (func(), error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return l.Wait(ctx, "www.example.com")
+	}
+
+	release1, _ := l.Wait(context.Background(), "www.example.com")
+	release2, _ := l.Wait(context.Background(), "www.example.com")
+
+	// 请求中修改限制, 并发数仍然包括请求中的请求
+	l.SetLimit("example.com", HostLimit{Rate: 100, Burst: 10, MaxInFlight: 2})
+	if _, err := wait(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+
+	release1()
+	release3, err := wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 降低并发数, 请求结束前不再放行
+	l.SetLimit("example.com", HostLimit{MaxInFlight: 1})
+	release2()
+	if _, err := wait(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+
+	// 提高并发数时唤醒等待中的请求
+	done := make(chan error, 1)
+	go func() {
+		release, err := l.Wait(context.Background(), "www.example.com")
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	l.SetLimit("example.com", HostLimit{MaxInFlight: 2})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("want waiter woken by SetLimit")
+	}
+	release3()
+}
+
+func TestHostLimiterCtx(t *testing.T) {
+	l := NewHostLimiter(HostLimit{Rate: 1, MaxInFlight: 1})
+
+	release, err := l.Wait(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发已满时等待被 context 取消
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.Wait(ctx, "www.example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+	release()
+
+	// 令牌不足时等待被 context 取消
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+	if _, err := l.Wait(ctx2, "www.example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestHostLimiterEvict(t *testing.T) {
+	l := NewHostLimiter(HostLimit{MaxInFlight: 2})
+	hosts := func() int {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.hosts)
+	}
+
+	// 没有请求时清理
+	release1, _ := l.Wait(context.Background(), "a.example.com")
+	release2, _ := l.Wait(context.Background(), "a.example.com")
+	release1()
+	if hosts() != 1 {
+		t.Errorf("want host kept while in flight, got %d", hosts())
+	}
+	release2()
+	release2()
+	if hosts() != 0 {
+		t.Errorf("want host evicted after release, got %d", hosts())
+	}
+
+	// 令牌桶未满时保留, 新增主机时清理已经恢复的主机
+	l.SetLimit("example.com", HostLimit{Rate: 100, Burst: 1})
+	for i := 0; i < hostLimiterSweepSize; i++ {
+		release, _ := l.Wait(context.Background(), "www"+strconv.Itoa(i)+".example.com")
+		release()
+	}
+	if hosts() != hostLimiterSweepSize {
+		t.Errorf("want %d hosts with empty buckets, got %d", hostLimiterSweepSize, hosts())
+	}
+	time.Sleep(20 * time.Millisecond)
+	release, _ := l.Wait(context.Background(), "www.example.com")
+	if hosts() != 1 {
+		t.Errorf("want idle hosts swept, got %d", hosts())
+	}
+	release()
+}
+
+func TestHttpGetRespLimiter(t *testing.T) {
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	req := &HttpReq{
+		HttpReq: &fun.HttpReq{},
+		Limiter: NewHostLimiter(HostLimit{MaxInFlight: 1}),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := *req
+			funReq := *req.HttpReq
+			r.HttpReq = &funReq
+			if _, err := HttpGetResp(server.URL, &r, 5000); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak != 1 {
+		t.Errorf("want max in flight 1, got %d", peak)
+	}
+}
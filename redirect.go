@@ -0,0 +1,63 @@
+package spider
+
+import (
+	"net/http"
+
+	"github.com/suosi-inc/go-pkg-spider/extract"
+)
+
+// HttpRedirect 一次 HTTP 跳转
+type HttpRedirect struct {
+	// 跳转前的请求地址
+	Url string
+
+	// Http 状态码, 如 301、302
+	StatusCode int
+
+	// 跳转地址, 已解析为绝对地址
+	Location string
+
+	// 是否跳转到其他主域名
+	CrossDomain bool
+
+	// 是否跳转到其他协议, 如 http 升级为 https
+	CrossScheme bool
+}
+
+// newHttpRedirect 根据跳转响应创建 HttpRedirect, 不是跳转响应时返回 false
+func newHttpRedirect(req *http.Request, resp *http.Response) (HttpRedirect, bool) {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return HttpRedirect{}, false
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return HttpRedirect{}, false
+	}
+
+	redirect := HttpRedirect{
+		Url:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Location:   location,
+	}
+
+	if u, err := req.URL.Parse(location); err == nil {
+		redirect.Location = u.String()
+		redirect.CrossScheme = u.Scheme != req.URL.Scheme
+		redirect.CrossDomain = redirectDomain(u.Hostname()) != redirectDomain(req.URL.Hostname())
+	}
+
+	return redirect, true
+}
+
+// redirectDomain 返回主域名, 无法获取主域名(如 IP)时返回主机名
+func redirectDomain(hostname string) string {
+	if domain := extract.DomainTop(hostname); domain != "" {
+		return domain
+	}
+
+	return hostname
+}
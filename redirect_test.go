@@ -0,0 +1,107 @@
+package spider
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/x-funs/go-fun"
+)
+
+func TestNewHttpRedirect(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/a/", nil)
+
+	for _, c := range []struct {
+		status      int
+		location    string
+		want        string
+		crossDomain bool
+		crossScheme bool
+	}{
+		{http.StatusMovedPermanently, "https://example.com/a/", "https://example.com/a/", false, true},
+		{http.StatusFound, "/b/", "http://example.com/b/", false, false},
+		{http.StatusFound, "http://www.example.com/", "http://www.example.com/", false, false},
+		{http.StatusPermanentRedirect, "https://www.example.org/", "https://www.example.org/", true, true},
+	} {
+		resp := &http.Response{StatusCode: c.status, Header: http.Header{"Location": []string{c.location}}}
+		redirect, ok := newHttpRedirect(req, resp)
+		if !ok || redirect.Url != "http://example.com/a/" || redirect.Location != c.want ||
+			redirect.CrossDomain != c.crossDomain || redirect.CrossScheme != c.crossScheme {
+			t.Errorf("unexpected redirect %+v for %s", redirect, c.location)
+		}
+	}
+
+	// 非跳转响应
+	if _, ok := newHttpRedirect(req, &http.Response{StatusCode: http.StatusNotModified, Header: http.Header{}}); ok {
+		t.Errorf("want no redirect for 304")
+	}
+}
+
+func TestHttpGetRespRedirects(t *testing.T) {
+	// 作为 HTTP 代理模拟多个域名
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "example.com":
+			http.Redirect(w, r, "http://www.example.com/", http.StatusMovedPermanently)
+		case "www.example.com":
+			if r.URL.Path == "/" {
+				http.Redirect(w, r, "/index.html", http.StatusFound)
+				return
+			}
+			http.Redirect(w, r, "http://www.example.org/", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(testHomeHtml()))
+		}
+	}))
+	defer ts.Close()
+
+	proxy, _ := NewProxyPool(ProxyRoundRobin, ts.URL)
+	req := &HttpReq{Proxy: proxy}
+
+	resp, err := HttpGetResp("http://example.com/", req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HttpRedirect{
+		{Url: "http://example.com/", StatusCode: 301, Location: "http://www.example.com/"},
+		{Url: "http://www.example.com/", StatusCode: 302, Location: "http://www.example.com/index.html"},
+		{Url: "http://www.example.com/index.html", StatusCode: 302, Location: "http://www.example.org/", CrossDomain: true},
+	}
+	if len(resp.Redirects) != len(want) {
+		t.Fatalf("want %d redirects, got %+v", len(want), resp.Redirects)
+	}
+	for i := range want {
+		if resp.Redirects[i] != want[i] {
+			t.Errorf("redirect %d want %+v, got %+v", i, want[i], resp.Redirects[i])
+		}
+	}
+
+	// 超过最大跳转次数时只记录已跟随的跳转, 返回的 3xx 响应不记录
+	resp, err = HttpGetResp("http://example.com/", &HttpReq{HttpReq: &fun.HttpReq{MaxRedirect: 1}, Proxy: proxy}, 5000)
+	if !errors.Is(err, ErrStatusCode) || len(resp.Redirects) != 1 || resp.Redirects[0] != want[0] {
+		t.Errorf("want 1 redirect with ErrStatusCode, got %+v %v", resp.Redirects, err)
+	}
+
+	// 禁止跳转时不记录
+	resp, err = HttpGetResp("http://example.com/", &HttpReq{HttpReq: &fun.HttpReq{DisableRedirect: true}, Proxy: proxy}, 5000)
+	if !errors.Is(err, ErrStatusCode) || len(resp.Redirects) != 0 {
+		t.Errorf("want no redirects with ErrStatusCode, got %+v %v", resp.Redirects, err)
+	}
+
+	// DomainRes 记录跳转链
+	domainRes, err := DetectDomainWithReq("example.com", req, 5000, 1)
+	var redirectErr *RedirectError
+	if !errors.As(err, &redirectErr) || redirectErr.Domain != "example.org" {
+		t.Fatalf("want redirect to example.org, got %v", err)
+	}
+	if len(domainRes.Redirects) != 2 || !domainRes.Redirects[1].CrossDomain {
+		t.Errorf("unexpected domain redirects %+v", domainRes.Redirects)
+	}
+	u, _ := url.Parse(domainRes.Redirects[0].Url)
+	if u.Host != "www.example.com" {
+		t.Errorf("want first hop from www.example.com, got %s", u.Host)
+	}
+}
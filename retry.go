@@ -0,0 +1,221 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy 重试策略, 指数退避 + 随机抖动, 仅对可重试的错误进行重试
+type RetryPolicy struct {
+	// 最大尝试次数(包含首次请求), <= 0 时为 1
+	MaxAttempts int
+
+	// 退避基础时间, 第 n 次重试前等待 BackoffBase * 2^(n-1)
+	BackoffBase time.Duration
+
+	// 退避最大时间
+	BackoffMax time.Duration
+
+	// 随机抖动比例, 范围 [0,1], 等待时间在 [wait*(1-Jitter), wait] 之间
+	Jitter float64
+
+	// 遵循 Retry-After 响应头, 超过 BackoffMax 时不再重试
+	RespectRetryAfter bool
+
+	// 判断错误是否可重试, 为空时使用 RetryableError
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy 默认重试策略, 重试次数由各方法的 retry 参数指定
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:       1,
+	BackoffBase:       500 * time.Millisecond,
+	BackoffMax:        10 * time.Second,
+	Jitter:            0.2,
+	RespectRetryAfter: true,
+}
+
+// NewRetryPolicy 基于 DefaultRetryPolicy 初始化指定最大尝试次数的重试策略
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	p := DefaultRetryPolicy
+	p.MaxAttempts = maxAttempts
+
+	return &p
+}
+
+// RetryableError 默认的可重试错误判断
+// 网络错误、读取失败、408/425/429/5xx 状态码可重试, context 取消、其他状态码、解析、编码、内容类型、跳转等错误不可重试
+func RetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+			http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
+	for _, e := range nonRetryableErrors {
+		if errors.Is(err, e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var nonRetryableErrors = []error{
+	ErrDocParse,
+	ErrCharset,
+	ErrContentType,
+	ErrContentLength,
+	ErrHttpParams,
+	ErrRedirect,
+	ErrRedirectHost,
+	ErrMetaJump,
+	ErrMetaJumpHost,
+	ErrTLSVerify,
+	ErrRequestVetoed,
+}
+
+// attempts 返回最大尝试次数
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts <= 0 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+// retryable 判断错误是否可重试
+func (p *RetryPolicy) retryable(err error) bool {
+	if p != nil && p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return RetryableError(err)
+}
+
+// Backoff 返回第 retry 次重试前的等待时间(从 1 开始), 第二个返回值为 false 表示不应再重试
+func (p *RetryPolicy) Backoff(retry int, err error) (time.Duration, bool) {
+	if p == nil {
+		p = &DefaultRetryPolicy
+	}
+
+	wait := time.Duration(0)
+	if p.BackoffBase > 0 {
+		exp := math.Pow(2, float64(retry-1))
+		wait = time.Duration(float64(p.BackoffBase) * exp)
+		if p.BackoffMax > 0 && (wait > p.BackoffMax || wait <= 0) {
+			wait = p.BackoffMax
+		}
+
+		if p.Jitter > 0 {
+			jitter := math.Min(p.Jitter, 1)
+			wait = wait - time.Duration(rand.Float64()*jitter*float64(wait))
+		}
+	}
+
+	if p.RespectRetryAfter {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if p.BackoffMax > 0 && statusErr.RetryAfter > p.BackoffMax {
+				return 0, false
+			}
+			if statusErr.RetryAfter > wait {
+				wait = statusErr.RetryAfter
+			}
+		}
+	}
+
+	return wait, true
+}
+
+// retryPolicy 返回请求使用的重试策略, HttpReq.RetryPolicy 优先, 否则使用 retry 次数
+func retryPolicy(req *HttpReq, retry int) *RetryPolicy {
+	if req != nil && req.RetryPolicy != nil {
+		return req.RetryPolicy
+	}
+
+	return NewRetryPolicy(retry)
+}
+
+// retryDo 按重试策略执行 fn, 失败时返回 RetryError, context 取消时返回 context 的错误
+func retryDo(ctx context.Context, p *RetryPolicy, sentinel error, fn func() error) error {
+	errs := make([]error, 0)
+
+	attempts := p.attempts()
+	for i := 0; i < attempts; i++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		errs = append(errs, err)
+
+		if i == attempts-1 || !p.retryable(err) {
+			break
+		}
+
+		wait, ok := p.Backoff(i+1, err)
+		if !ok {
+			break
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	return &RetryError{Err: sentinel, Errs: errs}
+}
+
+// parseRetryAfter 解析 Retry-After 响应头, 支持秒数和 HTTP 日期
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
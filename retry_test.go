@@ -0,0 +1,106 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryableError(t *testing.T) {
+	cases := map[error]bool{
+		ErrDo:                         true,
+		&StatusError{StatusCode: 503}: true,
+		&StatusError{StatusCode: 429}: true,
+		&StatusError{StatusCode: 404}: false,
+		ErrDocParse:                   false,
+		&RedirectError{Domain: "a.b"}: false,
+		context.Canceled:              false,
+		fetchError(nil, ErrDo):        true,
+	}
+
+	for err, want := range cases {
+		if got := RetryableError(err); got != want {
+			t.Errorf("RetryableError(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 5, BackoffBase: 100 * time.Millisecond, BackoffMax: time.Second}
+
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 5: time.Second} {
+		if wait, _ := p.Backoff(retry, ErrDo); wait != want {
+			t.Errorf("Backoff(%d) = %v, want %v", retry, wait, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if wait, _ := p.Backoff(2, ErrDo); wait < 100*time.Millisecond || wait > 200*time.Millisecond {
+			t.Fatalf("jitter wait %v out of range", wait)
+		}
+	}
+
+	p.RespectRetryAfter = true
+	if wait, ok := p.Backoff(1, &StatusError{StatusCode: 429, RetryAfter: 800 * time.Millisecond}); !ok || wait != 800*time.Millisecond {
+		t.Errorf("want Retry-After 800ms, got %v %v", wait, ok)
+	}
+	if _, ok := p.Backoff(1, &StatusError{StatusCode: 429, RetryAfter: time.Minute}); ok {
+		t.Errorf("want no retry when Retry-After exceeds BackoffMax")
+	}
+}
+
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(testHomeHtml()))
+	}))
+	defer ts.Close()
+
+	req := &HttpReq{RetryPolicy: &RetryPolicy{MaxAttempts: 3, BackoffBase: 10 * time.Millisecond, BackoffMax: 5 * time.Second, RespectRetryAfter: true}}
+
+	start := time.Now()
+	if _, err := GetLinkDataWithReq(ts.URL, false, req, 10000, 1); err != nil {
+		t.Fatal(err)
+	}
+	if spend := time.Since(start); spend < time.Second {
+		t.Errorf("want wait Retry-After 1s, spend %v", spend)
+	}
+	if count != 2 {
+		t.Errorf("want 2 requests, got %d", count)
+	}
+}
+
+func TestRetryDo(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, BackoffBase: time.Millisecond}
+
+	attempts := 0
+	err := retryDo(context.Background(), p, ErrRequest, func() error {
+		attempts++
+		return &StatusError{StatusCode: 502}
+	})
+
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Errs) != 3 || attempts != 3 {
+		t.Fatalf("want 3 attempts, got %d %v", attempts, err)
+	}
+
+	attempts = 0
+	_ = retryDo(context.Background(), p, ErrRequest, func() error {
+		attempts++
+		return ErrDocParse
+	})
+	if attempts != 1 {
+		t.Fatalf("want 1 attempt for ErrDocParse, got %d", attempts)
+	}
+}
@@ -0,0 +1,466 @@
+package spider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x-funs/go-fun"
+)
+
+const (
+	// RobotsMaxContentLength robots.txt 最大长度
+	RobotsMaxContentLength = 500 * 1024
+
+	// RobotsDisallowFilter 被 robots.txt 禁止的链接在 LinkData.Filters 中的原因
+	RobotsDisallowFilter = "invalid url with robots disallow"
+)
+
+var (
+	// DefaultRobotsCacheTTL robots.txt 默认缓存时间
+	DefaultRobotsCacheTTL = time.Hour
+
+	// DefaultRobotsErrorCacheTTL robots.txt 请求失败时的缓存时间, 避免长时间忽略 robots.txt
+	DefaultRobotsErrorCacheTTL = time.Minute
+)
+
+// Robots 解析后的 robots.txt
+type Robots struct {
+	// 分组
+	groups []*robotsGroup
+
+	// 是否禁止全部(robots.txt 服务端错误时)
+	disallowAll bool
+
+	// Sitemap 列表
+	Sitemaps []string
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// ParseRobots 解析 robots.txt, 支持 User-agent 分组、Allow/Disallow(通配符 * 和结尾 $)、Crawl-delay、Sitemap
+func ParseRobots(body []byte) *Robots {
+	robots := &Robots{}
+
+	var group *robotsGroup
+	// 连续的 User-agent 行属于同一分组
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), RobotsMaxContentLength)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents || group == nil {
+				group = &robotsGroup{}
+				robots.groups = append(robots.groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			// 空的 Disallow 表示允许全部, 忽略
+			if group == nil || value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if delay, err := strconv.ParseFloat(value, 64); err == nil && delay > 0 {
+				group.crawlDelay = time.Duration(delay * float64(time.Second))
+			}
+		case "sitemap":
+			// Sitemap 不属于任何分组
+			if value != "" {
+				robots.Sitemaps = append(robots.Sitemaps, value)
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	return robots
+}
+
+// group 返回匹配 userAgent 产品名称的分组, 没有时使用 *
+// 匹配同一名称的多个分组合并为一个分组, 参考 RFC 9309 2.2.1
+func (r *Robots) group(userAgent string) *robotsGroup {
+	token := robotsProductToken(userAgent)
+
+	var matched, wildcards []*robotsGroup
+	for _, g := range r.groups {
+		// 同一分组中 * 之后的具体名称仍然需要匹配
+		wildcard := false
+		match := false
+		for _, agent := range g.agents {
+			if agent == "*" {
+				wildcard = true
+				continue
+			}
+			if agent = robotsProductToken(agent); agent != "" && agent == token {
+				match = true
+				break
+			}
+		}
+
+		if match {
+			matched = append(matched, g)
+		} else if wildcard {
+			wildcards = append(wildcards, g)
+		}
+	}
+
+	if len(matched) > 0 {
+		return mergeRobotsGroups(matched)
+	}
+
+	return mergeRobotsGroups(wildcards)
+}
+
+// mergeRobotsGroups 合并分组的规则, Crawl-delay 使用第一个指定的值
+func mergeRobotsGroups(groups []*robotsGroup) *robotsGroup {
+	switch len(groups) {
+	case 0:
+		return nil
+	case 1:
+		return groups[0]
+	}
+
+	merged := &robotsGroup{}
+	for _, g := range groups {
+		merged.agents = append(merged.agents, g.agents...)
+		merged.rules = append(merged.rules, g.rules...)
+		if merged.crawlDelay == 0 {
+			merged.crawlDelay = g.crawlDelay
+		}
+	}
+
+	return merged
+}
+
+// robotsProductToken 返回小写的产品名称, 即第一个空白或 / 之前的部分, 如 "Googlebot/2.1 (+http://www.google.com/bot.html)" 为 googlebot
+func robotsProductToken(userAgent string) string {
+	token := strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(token, "/ \t"); i >= 0 {
+		token = token[:i]
+	}
+
+	return token
+}
+
+// Allowed 判断 userAgent 是否允许访问 urlStr, urlStr 可以是完整链接或路径
+// 最长匹配的规则优先, 长度相同时 Allow 优先
+func (r *Robots) Allowed(userAgent string, urlStr string) bool {
+	if r == nil {
+		return true
+	}
+
+	path := robotsPath(urlStr)
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+
+	g := r.group(userAgent)
+	if g == nil {
+		return true
+	}
+
+	allowed := true
+	matchedLen := -1
+	for _, rule := range g.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if l := len(rule.pattern); l > matchedLen || (l == matchedLen && rule.allow) {
+			allowed = rule.allow
+			matchedLen = l
+		}
+	}
+
+	return allowed
+}
+
+// CrawlDelay 返回 userAgent 的 Crawl-delay, 没有时为 0
+func (r *Robots) CrawlDelay(userAgent string) time.Duration {
+	if r == nil {
+		return 0
+	}
+
+	if g := r.group(userAgent); g != nil {
+		return g.crawlDelay
+	}
+
+	return 0
+}
+
+// robotsPath 返回链接的路径和查询参数
+func robotsPath(urlStr string) string {
+	if u, err := url.Parse(urlStr); err == nil {
+		path := u.EscapedPath()
+		if path == "" {
+			path = fun.SLASH
+		}
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		return path
+	}
+
+	return urlStr
+}
+
+// robotsMatch 匹配路径, pattern 支持 * 匹配任意字符, 结尾的 $ 匹配路径结尾
+func robotsMatch(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+
+	parts := strings.Split(pattern, "*")
+
+	// 第一段必须是前缀
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		// 锚定结尾时, 最后一段需要匹配结尾
+		if anchored && i == len(parts)-1 {
+			return len(path)-pos >= len(part) && strings.HasSuffix(path, part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+
+	if anchored {
+		return pos == len(path)
+	}
+
+	return true
+}
+
+// RobotsCache 按主机缓存 robots.txt
+type RobotsCache struct {
+	mu sync.Mutex
+
+	// 缓存时间
+	ttl time.Duration
+
+	entries map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	robots  *Robots
+	expires time.Time
+	done    chan struct{}
+}
+
+// NewRobotsCache 初始化 robots.txt 缓存, ttl <= 0 时使用 DefaultRobotsCacheTTL
+func NewRobotsCache(ttl time.Duration) *RobotsCache {
+	if ttl <= 0 {
+		ttl = DefaultRobotsCacheTTL
+	}
+
+	return &RobotsCache{
+		ttl:     ttl,
+		entries: make(map[string]*robotsEntry),
+	}
+}
+
+// Get 获取链接所在主机的 robots.txt, 优先使用缓存
+// robots.txt 不存在(4xx)时允许全部, 服务端错误(5xx)时禁止全部, 请求失败时允许全部并返回错误
+// 请求失败的结果只缓存 DefaultRobotsErrorCacheTTL
+// 如果 robots.txt 指定了 Crawl-delay, 会同步调整请求限速器中该主机的速率
+func (c *RobotsCache) Get(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*Robots, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Host == "" {
+		return nil, ErrHttpParams
+	}
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	entry, exists := c.entries[key]
+	if exists {
+		select {
+		case <-entry.done:
+			if time.Now().After(entry.expires) {
+				exists = false
+			}
+		default:
+		}
+	}
+	if !exists {
+		entry = &robotsEntry{done: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+
+		robots, err := fetchRobots(ctx, key+"/robots.txt", req, timeout)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			// 请求被取消时不缓存
+			c.mu.Lock()
+			delete(c.entries, key)
+			c.mu.Unlock()
+			close(entry.done)
+			return nil, ctxErr
+		}
+
+		ttl := c.ttl
+		if err != nil && DefaultRobotsErrorCacheTTL < ttl {
+			ttl = DefaultRobotsErrorCacheTTL
+		}
+		entry.robots = robots
+		entry.expires = time.Now().Add(ttl)
+		close(entry.done)
+
+		robotsCrawlDelay(robots, u.Hostname(), req)
+
+		return robots, err
+	}
+	c.mu.Unlock()
+
+	// 等待其他请求完成获取
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if entry.robots == nil {
+		return c.Get(ctx, urlStr, req, timeout)
+	}
+
+	return entry.robots, nil
+}
+
+// Allowed 判断请求是否允许访问链接, 获取 robots.txt 失败时允许
+func (c *RobotsCache) Allowed(ctx context.Context, urlStr string, req *HttpReq, timeout int) bool {
+	robots, _ := c.Get(ctx, urlStr, req, timeout)
+
+	return robots.Allowed(robotsUserAgent(req), urlStr)
+}
+
+// fetchRobots 请求 robots.txt
+func fetchRobots(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*Robots, error) {
+	r := &HttpReq{
+		HttpReq: &fun.HttpReq{
+			MaxContentLength: RobotsMaxContentLength,
+			MaxRedirect:      5,
+		},
+		ForceTextContentType: true,
+	}
+	inheritReq(r, req)
+
+	resp, err := r.fetcher().Fetch(ctx, urlStr, r, timeout)
+	if resp != nil && err == nil && resp.Success {
+		return ParseRobots(resp.Body), nil
+	}
+
+	statusCode := 0
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		statusCode = statusErr.StatusCode
+	} else if resp != nil && resp.HttpResp != nil {
+		statusCode = resp.StatusCode
+	}
+
+	if statusCode >= 400 && statusCode < 500 {
+		return &Robots{}, nil
+	}
+	if statusCode >= 500 {
+		return &Robots{disallowAll: true}, nil
+	}
+
+	return &Robots{}, fetchError(resp, err)
+}
+
+// robotsCrawlDelay 按 Crawl-delay 降低请求限速器中主机的速率
+func robotsCrawlDelay(robots *Robots, host string, req *HttpReq) {
+	delay := robots.CrawlDelay(robotsUserAgent(req))
+	if delay <= 0 {
+		return
+	}
+
+	limiter := req.limiter()
+	if limiter == nil {
+		return
+	}
+
+	limit := limiter.Limit(host)
+	rate := float64(time.Second) / float64(delay)
+	if limit.Rate <= 0 || limit.Rate > rate {
+		limit.Rate = rate
+		limit.Burst = 1
+		limiter.SetLimit(host, limit)
+	}
+}
+
+// robotsUserAgent 返回请求使用的 User-Agent
+func robotsUserAgent(req *HttpReq) string {
+	if req != nil && req.HttpReq != nil {
+		if req.UserAgent != "" {
+			return req.UserAgent
+		}
+		if ua, exists := req.Headers["User-Agent"]; exists {
+			return ua
+		}
+	}
+
+	return fun.HttpDefaultUserAgent
+}
+
+// robotsFilter 将 robots.txt 禁止的链接从 LinkRes 移到 Filters
+func robotsFilter(ctx context.Context, linkData *LinkData, req *HttpReq, timeout int) {
+	if req == nil || req.Robots == nil || linkData == nil || linkData.LinkRes == nil {
+		return
+	}
+
+	if linkData.Filters == nil {
+		linkData.Filters = make(map[string]string)
+	}
+
+	for _, links := range []map[string]string{linkData.LinkRes.Content, linkData.LinkRes.List, linkData.LinkRes.Unknown} {
+		for link := range links {
+			if !req.Robots.Allowed(ctx, link, req, timeout) {
+				delete(links, link)
+				linkData.Filters[link] = RobotsDisallowFilter
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package spider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRobotsTxt = `# robots.txt
+User-agent: *
+Disallow: /admin/
+Disallow: /*.php$
+Disallow: /search*q=
+Allow: /admin/public/
+Crawl-delay: 2
+
+User-agent: GoodBot
+User-agent: OtherBot
+Disallow:
+
+User-agent: BadBot
+Disallow: /
+
+Sitemap: http://www.example.com/sitemap.xml
+Sitemap: http://www.example.com/news_sitemap.xml
+`
+
+func TestParseRobots(t *testing.T) {
+	robots := ParseRobots([]byte(testRobotsTxt))
+
+	ua := HttpDefaultUserAgent
+	cases := map[string]bool{
+		"/":                         true,
+		"/news/2022/0901/1001.html": true,
+		"/admin/":                   false,
+		"/admin/login":              false,
+		"/admin/public/a.html":      true,
+		"/index.php":                false,
+		"/index.php?id=1":           true,
+		"/search?q=go":              false,
+		"/search":                   true,
+		"/robots.txt":               true,
+		"http://www.example.com/admin/index.html": false,
+	}
+	for path, want := range cases {
+		if got := robots.Allowed(ua, path); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	if !robots.Allowed("GoodBot/1.0 (+http://www.example.com/bot.html)", "/admin/") {
+		t.Error("GoodBot should be allowed")
+	}
+	// 只匹配产品名称, 不匹配 User-Agent 中其他位置的名称
+	if robots.Allowed("Mozilla/5.0 (compatible; GoodBot/1.0)", "/admin/") {
+		t.Error("GoodBot in comment should use *")
+	}
+	if robots.Allowed("Good", "/admin/") {
+		t.Error("Good should use *")
+	}
+	if !robots.Allowed("OtherBot", "/admin/") {
+		t.Error("OtherBot should be allowed")
+	}
+	if robots.Allowed("BadBot/2.1", "/news/") {
+		t.Error("BadBot should be disallowed")
+	}
+
+	if delay := robots.CrawlDelay(ua); delay != 2*time.Second {
+		t.Errorf("want crawl delay 2s, got %v", delay)
+	}
+	if delay := robots.CrawlDelay("GoodBot"); delay != 0 {
+		t.Errorf("want no crawl delay for GoodBot, got %v", delay)
+	}
+
+	if len(robots.Sitemaps) != 2 || robots.Sitemaps[1] != "http://www.example.com/news_sitemap.xml" {
+		t.Errorf("unexpected sitemaps %v", robots.Sitemaps)
+	}
+}
+
+func TestRobotsMergeGroups(t *testing.T) {
+	robots := ParseRobots([]byte(`User-agent: *
+Disallow: /admin/
+
+User-agent: NewsBot
+Disallow: /private/
+
+User-agent: *
+Disallow: /tmp/
+Crawl-delay: 3
+
+User-agent: newsbot/2.0
+Disallow: /draft/
+Allow: /private/public/
+Crawl-delay: 1
+`))
+
+	cases := []struct {
+		userAgent string
+		path      string
+		want      bool
+	}{
+		{"NewsBot/1.0", "/private/a.html", false},
+		{"NewsBot/1.0", "/private/public/a.html", true},
+		{"NewsBot/1.0", "/draft/a.html", false},
+		{"NewsBot/1.0", "/admin/", true},
+		{"OtherBot", "/admin/", false},
+		{"OtherBot", "/tmp/a", false},
+		{"OtherBot", "/private/a.html", true},
+	}
+	for _, c := range cases {
+		if got := robots.Allowed(c.userAgent, c.path); got != c.want {
+			t.Errorf("Allowed(%s, %s) = %v, want %v", c.userAgent, c.path, got, c.want)
+		}
+	}
+
+	if delay := robots.CrawlDelay("NewsBot"); delay != time.Second {
+		t.Errorf("want crawl delay 1s, got %v", delay)
+	}
+	if delay := robots.CrawlDelay("OtherBot"); delay != 3*time.Second {
+		t.Errorf("want crawl delay 3s, got %v", delay)
+	}
+
+	// 同一分组中 * 之后列出的具体名称
+	robots = ParseRobots([]byte(`User-agent: *
+User-agent: NewsBot
+Disallow: /shared/
+
+User-agent: *
+Disallow: /tmp/
+`))
+	if robots.Allowed("NewsBot", "/shared/a.html") {
+		t.Error("want NewsBot disallowed /shared/")
+	}
+	if !robots.Allowed("NewsBot", "/tmp/a.html") {
+		t.Error("want NewsBot allowed /tmp/")
+	}
+	if robots.Allowed("OtherBot", "/tmp/a.html") || robots.Allowed("OtherBot", "/shared/a.html") {
+		t.Error("want OtherBot disallowed /tmp/ and /shared/")
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.html", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php/", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/$", "/", true},
+		{"/$", "/a", false},
+		{"/a*b*c$", "/abcbc", true},
+		{"/a*bc$", "/abc", true},
+	}
+
+	for _, c := range cases {
+		if got := robotsMatch(c.pattern, c.path); got != c.want {
+			t.Errorf("robotsMatch(%s, %s) = %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
+
+func TestRobotsCache(t *testing.T) {
+	f := NewMemoryFetcher()
+	f.Add("http://www.example.com/robots.txt", &MemoryPage{
+		Headers: http.Header{"Content-Type": []string{"text/plain"}},
+		Body:    []byte(testRobotsTxt),
+	})
+	f.Add("http://down.example.com/robots.txt", &MemoryPage{StatusCode: http.StatusServiceUnavailable})
+
+	limiter := NewHostLimiter(HostLimit{Rate: 10})
+	req := &HttpReq{Fetcher: f, Limiter: limiter}
+	cache := NewRobotsCache(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cache.Allowed(context.Background(), "http://www.example.com/admin/", req, 1000) {
+				t.Error("want /admin/ disallowed")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if hits := f.Hits("http://www.example.com/robots.txt"); hits != 1 {
+		t.Errorf("want robots.txt fetched once, got %d", hits)
+	}
+
+	// Crawl-delay 调整限速
+	if rate := limiter.Limit("www.example.com").Rate; rate != 0.5 {
+		t.Errorf("want rate 0.5 by crawl delay, got %v", rate)
+	}
+
+	// robots.txt 不存在时允许全部
+	if !cache.Allowed(context.Background(), "http://news.example.com/admin/", req, 1000) {
+		t.Error("want allowed when robots.txt not found")
+	}
+
+	// 服务端错误时禁止全部
+	if cache.Allowed(context.Background(), "http://down.example.com/news/", req, 1000) {
+		t.Error("want disallowed when robots.txt 5xx")
+	}
+}
+
+func TestRobotsCacheError(t *testing.T) {
+	errorTTL := DefaultRobotsErrorCacheTTL
+	DefaultRobotsErrorCacheTTL = 50 * time.Millisecond
+	defer func() { DefaultRobotsErrorCacheTTL = errorTTL }()
+
+	var mu sync.Mutex
+	hits := 0
+	req := &HttpReq{Fetcher: FetcherFunc(func(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*HttpResp, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		return nil, ErrRequest
+	})}
+	cache := NewRobotsCache(time.Hour)
+
+	if _, err := cache.Get(context.Background(), "http://www.example.com/", req, 1000); err == nil {
+		t.Error("want error")
+	}
+	if !cache.Allowed(context.Background(), "http://www.example.com/admin/", req, 1000) {
+		t.Error("want allowed when robots.txt request failed")
+	}
+	if hits != 1 {
+		t.Errorf("want robots.txt fetched once, got %d", hits)
+	}
+
+	// 请求失败的结果只短暂缓存
+	time.Sleep(100 * time.Millisecond)
+	cache.Allowed(context.Background(), "http://www.example.com/admin/", req, 1000)
+	if hits != 2 {
+		t.Errorf("want robots.txt fetched again, got %d", hits)
+	}
+}
+
+func TestGetLinkDataWithRobots(t *testing.T) {
+	f := newTestFetcher()
+	f.AddHtml("http://www.example.com/robots.txt", "User-agent: *\nDisallow: /news/2022/0901/100*.html\nDisallow: /finance/\n")
+
+	req := &HttpReq{Fetcher: f, Robots: NewRobotsCache(0)}
+
+	linkData, err := GetLinkDataWithReq(testHomeUrl, true, req, 10000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1001-1009 被禁止
+	if len(linkData.LinkRes.Content) != 11 {
+		t.Errorf("want 11 content links, got %d", len(linkData.LinkRes.Content))
+	}
+	for link := range linkData.LinkRes.Content {
+		if strings.Contains(link, "/0901/100") {
+			t.Errorf("disallowed link %s in content", link)
+		}
+	}
+	if reason := linkData.Filters["http://www.example.com/news/2022/0901/1001.html"]; reason != RobotsDisallowFilter {
+		t.Errorf("want filter reason %q, got %q", RobotsDisallowFilter, reason)
+	}
+	if _, exists := linkData.LinkRes.List["http://www.example.com/finance/"]; exists {
+		t.Error("disallowed list link /finance/ in list")
+	}
+}
@@ -0,0 +1,343 @@
+package spider
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/suosi-inc/go-pkg-spider/extract"
+	"github.com/x-funs/go-fun"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// SitemapMaxContentLength sitemap 最大长度(解压后)
+	SitemapMaxContentLength = 50 * 1024 * 1024
+)
+
+var (
+	// SitemapPaths 约定的 sitemap 路径, robots.txt 中没有 Sitemap 时使用
+	SitemapPaths = []string{
+		"/sitemap.xml",
+		"/sitemap_index.xml",
+		"/sitemap-news.xml",
+		"/news-sitemap.xml",
+		"/sitemap_news.xml",
+	}
+
+	// SitemapMaxDepth sitemap 索引最大嵌套深度
+	SitemapMaxDepth = 3
+
+	// SitemapMaxCount 单次最多获取的 sitemap 数量
+	SitemapMaxCount = 100
+)
+
+// SitemapEntry sitemap 中的链接
+type SitemapEntry struct {
+	// 链接
+	Url string
+
+	// 最后修改时间 <lastmod>
+	LastMod time.Time
+
+	// 新闻标题 <news:title>
+	Title string
+
+	// 新闻发布时间 <news:publication_date>
+	PublicationDate time.Time
+
+	// 新闻语种 <news:language>
+	Lang string
+}
+
+// Time 返回链接的时间, 优先使用新闻发布时间
+func (e *SitemapEntry) Time() time.Time {
+	if !e.PublicationDate.IsZero() {
+		return e.PublicationDate
+	}
+
+	return e.LastMod
+}
+
+// Sitemap 解析后的 sitemap, 普通 sitemap 包含 Entries, 索引包含 Sitemaps
+type Sitemap struct {
+	// 链接列表
+	Entries []*SitemapEntry
+
+	// 子 sitemap 列表(sitemap 索引)
+	Sitemaps []string
+}
+
+type sitemapXml struct {
+	XMLName  xml.Name
+	Urls     []sitemapUrlXml `xml:"url"`
+	Sitemaps []sitemapUrlXml `xml:"sitemap"`
+}
+
+type sitemapUrlXml struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+	News    struct {
+		Title           string `xml:"title"`
+		PublicationDate string `xml:"publication_date"`
+		Publication     struct {
+			Language string `xml:"language"`
+		} `xml:"publication"`
+	} `xml:"news"`
+}
+
+// ParseSitemap 解析 sitemap, 支持 sitemap 索引、Google News sitemap、gzip 压缩和纯文本格式
+func ParseSitemap(body []byte) (*Sitemap, error) {
+	body, err := sitemapGunzip(body)
+	if err != nil {
+		return nil, err
+	}
+
+	sitemap := &Sitemap{}
+
+	trimmed := bytes.TrimSpace(body)
+	if !bytes.HasPrefix(trimmed, []byte("<")) {
+		// 纯文本格式, 每行一个链接
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+				sitemap.Entries = append(sitemap.Entries, &SitemapEntry{Url: line})
+			}
+		}
+		return sitemap, nil
+	}
+
+	var s sitemapXml
+	decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(&s); err != nil {
+		return nil, ErrDocParse
+	}
+
+	for _, u := range s.Urls {
+		loc := strings.TrimSpace(u.Loc)
+		if loc == "" {
+			continue
+		}
+		sitemap.Entries = append(sitemap.Entries, &SitemapEntry{
+			Url:             loc,
+			LastMod:         parseSitemapTime(u.LastMod),
+			Title:           strings.TrimSpace(u.News.Title),
+			PublicationDate: parseSitemapTime(u.News.PublicationDate),
+			Lang:            strings.TrimSpace(u.News.Publication.Language),
+		})
+	}
+
+	for _, u := range s.Sitemaps {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			sitemap.Sitemaps = append(sitemap.Sitemaps, loc)
+		}
+	}
+
+	return sitemap, nil
+}
+
+// DiscoverSitemaps 发现站点的 sitemap, 优先使用 robots.txt 中的 Sitemap, 没有时返回约定的路径(不保证存在)
+func DiscoverSitemaps(ctx context.Context, urlStr string, req *HttpReq, timeout int) ([]string, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Host == "" {
+		return nil, ErrHttpParams
+	}
+	base := u.Scheme + "://" + u.Host
+
+	var robots *Robots
+	if req != nil && req.Robots != nil {
+		robots, err = req.Robots.Get(ctx, base, req, timeout)
+	} else {
+		robots, err = fetchRobots(ctx, base+"/robots.txt", req, timeout)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	if err == nil && robots != nil && len(robots.Sitemaps) > 0 {
+		return robots.Sitemaps, nil
+	}
+
+	sitemaps := make([]string, 0, len(SitemapPaths))
+	for _, path := range SitemapPaths {
+		sitemaps = append(sitemaps, base+path)
+	}
+
+	return sitemaps, nil
+}
+
+// GetSitemap 获取并解析 sitemap, 不跟随 sitemap 索引
+func GetSitemap(ctx context.Context, urlStr string, req *HttpReq, timeout int) (*Sitemap, error) {
+	r := &HttpReq{
+		HttpReq: &fun.HttpReq{
+			MaxContentLength: SitemapMaxContentLength,
+			MaxRedirect:      3,
+		},
+		DisableCharset: true,
+	}
+	inheritReq(r, req)
+
+	resp, err := r.fetcher().Fetch(ctx, urlStr, r, timeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	if resp != nil && err == nil && resp.Success {
+		return ParseSitemap(resp.Body)
+	}
+
+	return nil, fetchError(resp, err)
+}
+
+// GetSitemapEntries 发现并获取站点全部 sitemap 中的链接, 跟随 sitemap 索引, 链接去重
+// 获取失败的 sitemap 会被忽略, 全部失败时返回最后一次错误
+func GetSitemapEntries(ctx context.Context, urlStr string, req *HttpReq, timeout int) ([]*SitemapEntry, error) {
+	sitemaps, err := DiscoverSitemaps(ctx, urlStr, req, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*SitemapEntry, 0)
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var lastErr error
+	success := false
+	count := 0
+
+	var walk func(sitemapUrl string, depth int) error
+	walk = func(sitemapUrl string, depth int) error {
+		if visited[sitemapUrl] || depth > SitemapMaxDepth || count >= SitemapMaxCount {
+			return nil
+		}
+		visited[sitemapUrl] = true
+		count++
+
+		sitemap, err := GetSitemap(ctx, sitemapUrl, req, timeout)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			lastErr = err
+			return nil
+		}
+		success = true
+
+		for _, entry := range sitemap.Entries {
+			if !seen[entry.Url] {
+				seen[entry.Url] = true
+				entries = append(entries, entry)
+			}
+		}
+
+		for _, child := range sitemap.Sitemaps {
+			if err := walk(child, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, sitemapUrl := range sitemaps {
+		if err := walk(sitemapUrl, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	if !success && lastErr != nil {
+		return nil, lastErr
+	}
+
+	return entries, nil
+}
+
+// SitemapLinkRes 将 sitemap 链接转换为内容页链接, 可直接用于 GetNews 的标题参数
+// domain 不为空时只保留该主域名下的链接, maxAge > 0 时只保留该时间内发布或修改的链接
+func SitemapLinkRes(entries []*SitemapEntry, domain string, maxAge time.Duration) *extract.LinkRes {
+	linkRes := &extract.LinkRes{
+		Content: make(map[string]string),
+		List:    make(map[string]string),
+		Unknown: make(map[string]string),
+		None:    make(map[string]string),
+	}
+
+	for _, entry := range entries {
+		if domain != "" {
+			u, err := url.Parse(entry.Url)
+			if err != nil || extract.DomainTop(u.Hostname()) != domain {
+				continue
+			}
+		}
+		if maxAge > 0 {
+			if t := entry.Time(); t.IsZero() || time.Since(t) > maxAge {
+				continue
+			}
+		}
+
+		linkRes.Content[entry.Url] = entry.Title
+	}
+
+	return linkRes
+}
+
+// sitemapGunzip 根据 gzip 文件头解压
+func sitemapGunzip(body []byte) ([]byte, error) {
+	if len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		return body, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, ErrGzip
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, SitemapMaxContentLength+1))
+	if err != nil {
+		return nil, ErrGzip
+	}
+	if len(data) > SitemapMaxContentLength {
+		return nil, ErrContentLength
+	}
+
+	return data, nil
+}
+
+// sitemapTimeLayouts W3C Datetime 格式
+var sitemapTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseSitemapTime 解析 sitemap 时间, 失败时返回零值
+func parseSitemapTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range sitemapTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,151 @@
+package spider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testNewsSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:news="http://www.google.com/schemas/sitemap-news/0.9">
+  <url>
+    <loc>http://www.example.com/news/2022/0901/1001.html</loc>
+    <lastmod>2022-09-01T10:30:00+08:00</lastmod>
+    <news:news>
+      <news:publication>
+        <news:name>示例新闻网</news:name>
+        <news:language>zh</news:language>
+      </news:publication>
+      <news:publication_date>2022-09-01T10:00:00+08:00</news:publication_date>
+      <news:title>国务院办公厅印发关于进一步优化营商环境的意见</news:title>
+    </news:news>
+  </url>
+  <url>
+    <loc>http://www.example.com/about.html</loc>
+    <lastmod>2020-01-02</lastmod>
+  </url>
+  <url>
+    <loc>http://www.other.com/news/1.html</loc>
+  </url>
+</urlset>`
+
+const testSitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>http://www.example.com/sitemap-news.xml.gz</loc></sitemap>
+  <sitemap><loc>http://www.example.com/sitemap-missing.xml</loc></sitemap>
+</sitemapindex>`
+
+func testGzip(data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+
+	return buf.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	sitemap, err := ParseSitemap([]byte(testNewsSitemap))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sitemap.Entries) != 3 {
+		t.Fatalf("want 3 entries, got %d", len(sitemap.Entries))
+	}
+
+	entry := sitemap.Entries[0]
+	if entry.Title != "国务院办公厅印发关于进一步优化营商环境的意见" || entry.Lang != "zh" {
+		t.Errorf("unexpected news entry %+v", entry)
+	}
+	if want := time.Date(2022, 9, 1, 2, 0, 0, 0, time.UTC); !entry.PublicationDate.Equal(want) || !entry.Time().Equal(want) {
+		t.Errorf("want publication date %v, got %v", want, entry.PublicationDate)
+	}
+	if want := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC); !sitemap.Entries[1].LastMod.Equal(want) {
+		t.Errorf("want lastmod %v, got %v", want, sitemap.Entries[1].LastMod)
+	}
+
+	// sitemap 索引
+	index, err := ParseSitemap([]byte(testSitemapIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Sitemaps) != 2 || len(index.Entries) != 0 {
+		t.Errorf("unexpected sitemap index %+v", index)
+	}
+
+	// gzip
+	gz, err := ParseSitemap(testGzip(testNewsSitemap))
+	if err != nil || len(gz.Entries) != 3 {
+		t.Errorf("want 3 entries from gzip, got %v %v", gz, err)
+	}
+
+	// 纯文本
+	text, err := ParseSitemap([]byte("http://www.example.com/a.html\n\nhttp://www.example.com/b.html\n"))
+	if err != nil || len(text.Entries) != 2 {
+		t.Errorf("want 2 entries from text, got %v %v", text, err)
+	}
+}
+
+func newTestSitemapFetcher() *MemoryFetcher {
+	f := newTestFetcher()
+	f.AddHtml("http://www.example.com/robots.txt", "User-agent: *\nDisallow:\nSitemap: http://www.example.com/sitemap_index.xml\n")
+	f.Add("http://www.example.com/sitemap_index.xml", &MemoryPage{
+		Headers: http.Header{"Content-Type": []string{"application/xml"}},
+		Body:    []byte(testSitemapIndex),
+	})
+	f.Add("http://www.example.com/sitemap-news.xml.gz", &MemoryPage{
+		Headers: http.Header{"Content-Type": []string{"application/x-gzip"}},
+		Body:    testGzip(testNewsSitemap),
+	})
+
+	return f
+}
+
+func TestGetSitemapEntries(t *testing.T) {
+	f := newTestSitemapFetcher()
+	req := &HttpReq{Fetcher: f}
+
+	sitemaps, err := DiscoverSitemaps(context.Background(), testHomeUrl, req, 1000)
+	if err != nil || len(sitemaps) != 1 || sitemaps[0] != "http://www.example.com/sitemap_index.xml" {
+		t.Fatalf("unexpected sitemaps %v %v", sitemaps, err)
+	}
+
+	entries, err := GetSitemapEntries(context.Background(), testHomeUrl, req, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("want 3 entries, got %d", len(entries))
+	}
+	if f.Hits("http://www.example.com/sitemap-missing.xml") != 1 {
+		t.Error("want missing sitemap requested")
+	}
+
+	linkRes := SitemapLinkRes(entries, "example.com", 0)
+	if len(linkRes.Content) != 2 {
+		t.Errorf("want 2 content links in example.com, got %d", len(linkRes.Content))
+	}
+	if title := linkRes.Content[testArticleUrl]; title != "国务院办公厅印发关于进一步优化营商环境的意见" {
+		t.Errorf("want news title, got %q", title)
+	}
+
+	// 没有 robots.txt 时使用约定路径
+	sitemaps, _ = DiscoverSitemaps(context.Background(), "http://news.example.com/a.html", req, 1000)
+	if len(sitemaps) != len(SitemapPaths) || sitemaps[0] != "http://news.example.com/sitemap.xml" {
+		t.Errorf("unexpected sitemaps %v", sitemaps)
+	}
+}
+
+func TestNewsSpiderWithSitemap(t *testing.T) {
+	// 深度为 0, 只采集 sitemap 中的链接
+	n := NewNewsSpider(testHomeUrl, 0, nil, nil, WithFetcher(newTestSitemapFetcher()), WithRetryTime(1), WithSitemap(0))
+
+	contents := collectNews(t, n)
+	if len(contents) != 1 || contents[0].Url != testArticleUrl {
+		t.Fatalf("want 1 content from %s, got %d", testArticleUrl, len(contents))
+	}
+}
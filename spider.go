@@ -2,7 +2,9 @@ package spider
 
 import (
 	"bytes"
-	"errors"
+	"context"
+	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 
@@ -29,90 +31,58 @@ type LinkData struct {
 	LinkRes    *extract.LinkRes
 	Filters    map[string]string
 	SubDomains map[string]bool
+	Trace      *HttpTrace // 请求耗时和网络信息, 仅设置 HttpReq.Trace 时记录
 }
 
 // GetLinkData 获取页面链接数据
 func GetLinkData(urlStr string, strictDomain bool, timeout int, retry int) (*LinkData, error) {
-	if retry <= 0 {
-		retry = 1
-	}
-
-	errs := make([]string, 0)
-
-	for i := 0; i < retry; i++ {
-		linkData, err := GetLinkDataDo(urlStr, strictDomain, nil, nil, timeout)
-		if err == nil {
-			return linkData, err
-		} else {
-			errs = append(errs, err.Error())
-		}
-	}
+	return GetLinkDataWithReqAndRuleCtx(context.Background(), urlStr, strictDomain, nil, nil, timeout, retry)
+}
 
-	return nil, errors.New("ErrorLinkRes" + fun.ToString(errs))
+// GetLinkDataCtx 获取页面链接数据, 支持 context 取消
+func GetLinkDataCtx(ctx context.Context, urlStr string, strictDomain bool, timeout int, retry int) (*LinkData, error) {
+	return GetLinkDataWithReqAndRuleCtx(ctx, urlStr, strictDomain, nil, nil, timeout, retry)
 }
 
 // GetLinkDataWithReq 获取页面链接数据
 func GetLinkDataWithReq(urlStr string, strictDomain bool, req *HttpReq, timeout int, retry int) (*LinkData, error) {
-	if retry <= 0 {
-		retry = 1
-	}
-
-	errs := make([]string, 0)
-
-	for i := 0; i < retry; i++ {
-		linkData, err := GetLinkDataDo(urlStr, strictDomain, nil, req, timeout)
-		if err == nil {
-			return linkData, err
-		} else {
-			errs = append(errs, err.Error())
-		}
-	}
-
-	return nil, errors.New("ErrorLinkRes" + fun.ToString(errs))
+	return GetLinkDataWithReqAndRuleCtx(context.Background(), urlStr, strictDomain, nil, req, timeout, retry)
 }
 
 // GetLinkDataWithReqAndRule 获取页面链接数据
 func GetLinkDataWithReqAndRule(urlStr string, strictDomain bool, rules extract.LinkTypeRule, req *HttpReq, timeout int, retry int) (*LinkData, error) {
-	if retry <= 0 {
-		retry = 1
-	}
-
-	errs := make([]string, 0)
-
-	for i := 0; i < retry; i++ {
-		linkData, err := GetLinkDataDo(urlStr, strictDomain, rules, req, timeout)
-		if err == nil {
-			return linkData, err
-		} else {
-			errs = append(errs, err.Error())
-		}
-	}
-
-	return nil, errors.New("ErrorLinkRes" + fun.ToString(errs))
+	return GetLinkDataWithReqAndRuleCtx(context.Background(), urlStr, strictDomain, rules, req, timeout, retry)
 }
 
 // GetLinkDataWithRule 获取页面链接数据
 func GetLinkDataWithRule(urlStr string, strictDomain bool, rules extract.LinkTypeRule, timeout int, retry int) (*LinkData, error) {
-	if retry <= 0 {
-		retry = 1
-	}
-
-	errs := make([]string, 0)
+	return GetLinkDataWithReqAndRuleCtx(context.Background(), urlStr, strictDomain, rules, nil, timeout, retry)
+}
 
-	for i := 0; i < retry; i++ {
-		linkData, err := GetLinkDataDo(urlStr, strictDomain, rules, nil, timeout)
-		if err == nil {
-			return linkData, err
-		} else {
-			errs = append(errs, err.Error())
-		}
+// GetLinkDataWithReqAndRuleCtx 获取页面链接数据, 支持 context 取消
+// 按重试策略重试 retry 次, 见 RetryPolicy
+func GetLinkDataWithReqAndRuleCtx(ctx context.Context, urlStr string, strictDomain bool, rules extract.LinkTypeRule, req *HttpReq, timeout int, retry int) (*LinkData, error) {
+	var linkData *LinkData
+
+	err := retryDo(ctx, retryPolicy(req, retry), ErrLinkRes, func() error {
+		var err error
+		linkData, err = GetLinkDataDoCtx(ctx, urlStr, strictDomain, rules, req, timeout)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("ErrorLinkRes" + fun.ToString(errs))
+	return linkData, nil
 }
 
 // GetLinkDataDo 获取页面链接数据
 func GetLinkDataDo(urlStr string, strictDomain bool, rules extract.LinkTypeRule, req *HttpReq, timeout int) (*LinkData, error) {
+	return GetLinkDataDoCtx(context.Background(), urlStr, strictDomain, rules, req, timeout)
+}
+
+// GetLinkDataDoCtx 获取页面链接数据, 支持 context 取消
+func GetLinkDataDoCtx(ctx context.Context, urlStr string, strictDomain bool, rules extract.LinkTypeRule, req *HttpReq, timeout int) (*LinkData, error) {
 	if timeout == 0 {
 		timeout = 10000
 	}
@@ -127,84 +97,112 @@ func GetLinkDataDo(urlStr string, strictDomain bool, rules extract.LinkTypeRule,
 		}
 	}
 
-	resp, err := HttpGetResp(urlStr, req, timeout)
-	if resp != nil && err == nil && resp.Success {
-		// 解析 HTML
-		doc, docErr := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
-		if docErr == nil {
-			linkData := &LinkData{}
+	resp, err := req.fetcher().Fetch(ctx, urlStr, req, timeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
 
-			doc.Find(DefaultDocRemoveTags).Remove()
+	if resp != nil && err == nil && resp.Success {
+		linkData, err := linkDataFromUtf8(resp.Body, resp.Charset.Charset, resp.RequestURL, strictDomain, rules)
+		if err == nil {
+			linkData.Trace = resp.Trace
+			robotsFilter(ctx, linkData, req, timeout)
+		}
+		return linkData, err
+	}
 
-			// 语言
-			langRes := Lang(doc, resp.Charset.Charset, true)
+	return nil, fetchError(resp, err)
+}
 
-			// 站内链接
-			linkTitles, filters := extract.WebLinkTitles(doc, resp.RequestURL, strictDomain)
+// GetLinkDataFromHTML 从已保存的 HTML 获取页面链接数据, 无需请求
+// 参数为原始编码的 body, 响应头(可为空), 页面原始地址, 自动完成编码探测转换、语种识别和链接分类
+func GetLinkDataFromHTML(body []byte, headers *http.Header, urlStr string, strictDomain bool, rules extract.LinkTypeRule) (*LinkData, error) {
+	u, err := fun.UrlParse(urlStr)
+	if err != nil {
+		return nil, err
+	}
 
-			// 链接分类
-			linkRes, subDomains := extract.LinkTypes(linkTitles, langRes.Lang, rules)
+	utf8Body, charsetRes, err := charsetToUtf8(body, headers)
+	if err != nil {
+		return nil, err
+	}
 
-			linkData.LinkRes = linkRes
-			linkData.Filters = filters
-			linkData.SubDomains = subDomains
+	return linkDataFromUtf8(utf8Body, charsetRes.Charset, u, strictDomain, rules)
+}
 
-			return linkData, nil
-		} else {
-			return nil, errors.New("ErrorDocParse")
-		}
+// linkDataFromUtf8 解析 UTF-8 HTML 获取页面链接数据
+func linkDataFromUtf8(body []byte, charset string, baseUrl *url.URL, strictDomain bool, rules extract.LinkTypeRule) (*LinkData, error) {
+	// 解析 HTML
+	doc, docErr := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if docErr != nil {
+		return nil, ErrDocParse
 	}
 
-	return nil, errors.New("ErrorRequest")
+	linkData := &LinkData{}
+
+	doc.Find(DefaultDocRemoveTags).Remove()
+
+	// 语言
+	langRes := Lang(doc, charset, true)
+
+	// 站内链接
+	linkTitles, filters := extract.WebLinkTitles(doc, baseUrl, strictDomain)
+
+	// 链接分类
+	linkRes, subDomains := extract.LinkTypes(linkTitles, langRes.Lang, rules)
+
+	linkData.LinkRes = linkRes
+	linkData.Filters = filters
+	linkData.SubDomains = subDomains
+
+	return linkData, nil
 }
 
 // GetNews 获取链接新闻数据
 func GetNews(urlStr string, title string, timeout int, retry int) (*extract.News, *HttpResp, error) {
-	if retry <= 0 {
-		retry = 1
-	}
-
-	errs := make([]string, 0)
-
-	for i := 0; i < retry; i++ {
-		news, resp, err := GetNewsDo(urlStr, title, nil, timeout)
-		if err == nil {
-			return news, resp, nil
-		} else {
-			errs = append(errs, err.Error())
-		}
-	}
+	return GetNewsWithReqCtx(context.Background(), urlStr, title, nil, timeout, retry)
+}
 
-	return nil, nil, errors.New("ErrorRequest" + fun.ToString(errs))
+// GetNewsCtx 获取链接新闻数据, 支持 context 取消
+func GetNewsCtx(ctx context.Context, urlStr string, title string, timeout int, retry int) (*extract.News, *HttpResp, error) {
+	return GetNewsWithReqCtx(ctx, urlStr, title, nil, timeout, retry)
 }
 
 // GetNewsWithReq 获取链接新闻数据
 func GetNewsWithReq(urlStr string, title string, req *HttpReq, timeout int, retry int) (*extract.News, *HttpResp, error) {
-	if retry <= 0 {
-		retry = 1
-	}
-
-	errs := make([]string, 0)
+	return GetNewsWithReqCtx(context.Background(), urlStr, title, req, timeout, retry)
+}
 
-	for i := 0; i < retry; i++ {
-		news, resp, err := GetNewsDo(urlStr, title, req, timeout)
-		if err == nil {
-			return news, resp, nil
-		} else {
-			errs = append(errs, err.Error())
-		}
+// GetNewsWithReqCtx 获取链接新闻数据, 支持 context 取消
+// 按重试策略重试 retry 次, 见 RetryPolicy
+func GetNewsWithReqCtx(ctx context.Context, urlStr string, title string, req *HttpReq, timeout int, retry int) (*extract.News, *HttpResp, error) {
+	var news *extract.News
+	var resp *HttpResp
+
+	err := retryDo(ctx, retryPolicy(req, retry), ErrRequest, func() error {
+		var err error
+		news, resp, err = GetNewsDoCtx(ctx, urlStr, title, req, timeout)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil, nil, errors.New("ErrorRequest" + fun.ToString(errs))
+	return news, resp, nil
 }
 
 // GetNewsDo 获取链接新闻数据
 func GetNewsDo(urlStr string, title string, req *HttpReq, timeout int) (*extract.News, *HttpResp, error) {
-	return getNewsDoTop(urlStr, title, req, timeout, true)
+	return getNewsDoTop(context.Background(), urlStr, title, req, timeout, true)
+}
+
+// GetNewsDoCtx 获取链接新闻数据, 支持 context 取消
+func GetNewsDoCtx(ctx context.Context, urlStr string, title string, req *HttpReq, timeout int) (*extract.News, *HttpResp, error) {
+	return getNewsDoTop(ctx, urlStr, title, req, timeout, true)
 }
 
 // getNewsDoTop 获取链接新闻数据
-func getNewsDoTop(urlStr string, title string, req *HttpReq, timeout int, top bool) (*extract.News, *HttpResp, error) {
+func getNewsDoTop(ctx context.Context, urlStr string, title string, req *HttpReq, timeout int, top bool) (*extract.News, *HttpResp, error) {
 	if timeout == 0 {
 		timeout = HttpDefaultTimeOut
 	}
@@ -219,7 +217,10 @@ func getNewsDoTop(urlStr string, title string, req *HttpReq, timeout int, top bo
 		}
 	}
 
-	resp, err := HttpGetResp(urlStr, req, timeout)
+	resp, err := req.fetcher().Fetch(ctx, urlStr, req, timeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, resp, ctxErr
+	}
 
 	if resp != nil && err == nil && resp.Success {
 		doc, docErr := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
@@ -239,25 +240,50 @@ func getNewsDoTop(urlStr string, title string, req *HttpReq, timeout int, top bo
 							refreshHostname := r.Hostname()
 							refreshTopDomain := extract.DomainTop(refreshHostname)
 							if refreshTopDomain != "" && refreshTopDomain == requestTopDomain {
-								return getNewsDoTop(refreshUrl, title, req, timeout, false)
+								return getNewsDoTop(ctx, refreshUrl, title, req, timeout, false)
 							}
 						}
 					}
 				}
 			}
 
-			// 语言
-			langRes := Lang(doc, resp.Charset.Charset, false)
-
-			// 正文抽取
-			content := extract.NewContent(contentDoc, langRes.Lang, title, urlStr)
-			news := content.ExtractNews()
+			news := extractNews(contentDoc, doc, resp.Charset.Charset, urlStr, title)
 
 			return news, resp, nil
 		} else {
-			return nil, resp, errors.New("ErrorDocParse")
+			return nil, resp, ErrDocParse
 		}
 	}
 
-	return nil, nil, errors.New("ErrorRequest")
+	return nil, nil, fetchError(resp, err)
+}
+
+// GetNewsFromHTML 从已保存的 HTML 获取新闻数据, 无需请求
+// 参数为原始编码的 body, 响应头(可为空), 页面原始地址, 列表页标题(可为空), 自动完成编码探测转换、语种识别和正文抽取
+func GetNewsFromHTML(body []byte, headers *http.Header, urlStr string, title string) (*extract.News, error) {
+	utf8Body, charsetRes, err := charsetToUtf8(body, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, docErr := goquery.NewDocumentFromReader(bytes.NewReader(utf8Body))
+	if docErr != nil {
+		return nil, ErrDocParse
+	}
+
+	contentDoc := goquery.CloneDocument(doc)
+	doc.Find(DefaultDocRemoveTags).Remove()
+
+	return extractNews(contentDoc, doc, charsetRes.Charset, urlStr, title), nil
+}
+
+// extractNews 语种识别和正文抽取, contentDoc 为原始文档, doc 为已清理的文档
+func extractNews(contentDoc *goquery.Document, doc *goquery.Document, charset string, urlStr string, title string) *extract.News {
+	// 语言
+	langRes := Lang(doc, charset, false)
+
+	// 正文抽取
+	content := extract.NewContent(contentDoc, langRes.Lang, title, urlStr)
+
+	return content.ExtractNews()
 }
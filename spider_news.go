@@ -1,10 +1,15 @@
 package spider
 
 import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/suosi-inc/go-pkg-spider/extract"
 	"github.com/x-funs/go-fun"
 )
 
@@ -13,24 +18,39 @@ type NewsSpider struct {
 	Url         string            // 根链接
 	Depth       uint8             // 采集页面深度
 	seen        map[string]bool   // 是否已采集
+	seenMu      *sync.Mutex       // seen 的锁, 列表页、sitemap、Feed 和内容页的协程并发访问
 	IsSub       bool              // 是否采集子域名
 	linkChan    chan *NewsData    // NewsData 通道共享
 	contentChan chan *NewsContent // NewsContent 通道共享
 	ProcessFunc func(...any)      // 处理函数
 	RetryTime   int               // 请求重试次数
+	RetryPolicy *RetryPolicy      // 重试策略, 为空时按 RetryTime 使用默认重试策略
 	TimeOut     int               // 请求响应时间
 	wg          *sync.WaitGroup   // 同步等待组
 	Req         *HttpReq          // 请求体
+	Fetcher     Fetcher           // 页面获取方式, 为空时使用 Req.Fetcher 或 DefaultFetcher
+	Limiter     *HostLimiter      // 主机限速器, 默认按 DefaultNewsSpiderHostLimit 限制
+	Robots      *RobotsCache      // robots.txt 缓存, 不为空时跳过 robots.txt 禁止的链接
+	Sitemap     bool              // 是否使用 sitemap 中的链接作为内容页种子
+	SitemapAge  time.Duration     // sitemap 链接的最大发布时间间隔, 0 时不限制
+	Feed        bool              // 是否使用首页声明的 RSS、Atom、JSON Feed 作为列表页
+	Transport   TransportProfile  // 请求体未指定 Transport 时使用的 Transport 配置, 默认复用连接
+	Proxy       *ProxyPool        // 代理池
+	Cache       CacheStore        // 列表页响应缓存
+	Jar         http.CookieJar    // Cookie 容器, 采集首页时建立的会话会带到列表页和内容页请求
+	Middlewares []Middleware      // 请求中间件, 在请求体的中间件外层
+	Trace       bool              // 是否记录请求耗时和网络信息到 NewsData.Trace、NewsContent.Trace
 	Ctx         any               // 任务详情上下文，传入ProcessFunc函数中
 }
 
 // 新闻内容结构体
 type NewsContent struct {
-	Url     string // 链接
-	Title   string // 标题
-	Time    string // 发布时间
-	Content string // 正文纯文本
-	Lang    string // 语种
+	Url     string     // 链接
+	Title   string     // 标题
+	Time    string     // 发布时间
+	Content string     // 正文纯文本
+	Lang    string     // 语种
+	Trace   *HttpTrace // 请求耗时和网络信息
 }
 
 // 新闻LinkData总数据
@@ -55,6 +75,7 @@ func NewNewsSpider(url string, depth uint8, pf func(...any), ctx any, options ..
 		Url:         url,
 		Depth:       depth,
 		seen:        map[string]bool{},
+		seenMu:      &sync.Mutex{},
 		IsSub:       false,
 		linkChan:    make(chan *NewsData),
 		contentChan: make(chan *NewsContent),
@@ -63,6 +84,8 @@ func NewNewsSpider(url string, depth uint8, pf func(...any), ctx any, options ..
 		TimeOut:     20000,
 		wg:          &sync.WaitGroup{},
 		Req:         nil,
+		Limiter:     NewHostLimiter(DefaultNewsSpiderHostLimit),
+		Transport:   TransportPooled,
 		Ctx:         ctx,
 	}
 
@@ -80,6 +103,12 @@ func WithRetryTime(retryTime int) Option {
 	}
 }
 
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(n *NewsSpider) {
+		n.RetryPolicy = policy
+	}
+}
+
 func WithTimeOut(timeout int) Option {
 	return func(n *NewsSpider) {
 		n.TimeOut = timeout
@@ -98,12 +127,84 @@ func WithIsSub(isSub bool) Option {
 	}
 }
 
+func WithFetcher(fetcher Fetcher) Option {
+	return func(n *NewsSpider) {
+		n.Fetcher = fetcher
+	}
+}
+
+func WithHostLimiter(limiter *HostLimiter) Option {
+	return func(n *NewsSpider) {
+		n.Limiter = limiter
+	}
+}
+
+func WithRobots(robots *RobotsCache) Option {
+	return func(n *NewsSpider) {
+		n.Robots = robots
+	}
+}
+
+// WithCookieJar 设置 Cookie 容器, jar 为空时创建一个新的 Cookie 容器
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(n *NewsSpider) {
+		if jar == nil {
+			jar = NewCookieJar()
+		}
+		n.Jar = jar
+	}
+}
+
+func WithMiddleware(mw ...Middleware) Option {
+	return func(n *NewsSpider) {
+		n.Middlewares = append(n.Middlewares, mw...)
+	}
+}
+
+func WithTrace(trace bool) Option {
+	return func(n *NewsSpider) {
+		n.Trace = trace
+	}
+}
+
+func WithSitemap(maxAge time.Duration) Option {
+	return func(n *NewsSpider) {
+		n.Sitemap = true
+		n.SitemapAge = maxAge
+	}
+}
+
+func WithFeed(feed bool) Option {
+	return func(n *NewsSpider) {
+		n.Feed = feed
+	}
+}
+
+func WithTransportProfile(profile TransportProfile) Option {
+	return func(n *NewsSpider) {
+		n.Transport = profile
+	}
+}
+
+func WithProxyPool(pool *ProxyPool) Option {
+	return func(n *NewsSpider) {
+		n.Proxy = pool
+	}
+}
+
+func WithCache(cache CacheStore) Option {
+	return func(n *NewsSpider) {
+		n.Cache = cache
+	}
+}
+
 // 原型链结构体拷贝
 func (n *NewsSpider) Clone() Prototype {
 	nc := *n
 
 	// 拷贝时需重置chan和wg等字段
 	nc.seen = map[string]bool{}
+	nc.seenMu = &sync.Mutex{}
 	nc.linkChan = make(chan *NewsData)
 	nc.contentChan = make(chan *NewsContent)
 	nc.wg = &sync.WaitGroup{}
@@ -127,8 +228,8 @@ func (n *NewsSpider) GetNews(linksHandleFunc func(*NewsData)) {
 	listSliceTemp = append(listSliceTemp, n.Url)
 
 	if n.IsSub {
-		// 先探测出首页url的所有子域名
-		subDomains, _ := GetSubdomains(indexUrl, n.Req, n.TimeOut, n.RetryTime*100)
+		// 先探测出首页url的所有子域名, 重试次数与列表页一致, 重试之间按 RetryPolicy 退避
+		subDomains, _ := GetSubdomains(indexUrl, n.listReq(), n.TimeOut, n.RetryTime)
 
 		for subDomain := range subDomains {
 			subDomainSlice = append(subDomainSlice, subDomain)
@@ -136,6 +237,16 @@ func (n *NewsSpider) GetNews(linksHandleFunc func(*NewsData)) {
 		}
 	}
 
+	// sitemap 中的链接作为内容页种子
+	if n.Sitemap {
+		n.GetSitemapLinkRes(linksHandleFunc, indexUrl)
+	}
+
+	// Feed 作为列表页
+	if n.Feed {
+		n.GetFeedLinkRes(linksHandleFunc, indexUrl)
+	}
+
 	// 深度优先循环遍历获取页面列表页和内容页
 	for i := 0; i < int(n.Depth); i++ {
 		listS, _ := n.GetNewsLinkRes(linksHandleFunc, scheme, listSliceTemp, uint8(i+1), n.TimeOut, n.RetryTime)
@@ -158,10 +269,15 @@ func (n *NewsSpider) GetNewsLinkRes(linksHandleFunc func(*NewsData), scheme stri
 			url = scheme + url
 		}
 
-		if linkData, err := GetLinkDataWithReq(url, true, n.Req, timeout, retry); err == nil {
+		// 跳过 robots.txt 禁止的列表页
+		req := n.listReq()
+		if n.Robots != nil && !n.Robots.Allowed(context.Background(), url, req, timeout) {
+			continue
+		}
+
+		if linkData, err := GetLinkDataWithReq(url, true, req, timeout, retry); err == nil {
 			for l := range linkData.LinkRes.List {
-				if !n.seen[l] {
-					n.seen[l] = true
+				if n.markSeen(l) {
 					listSlice = append(listSlice, l)
 				}
 			}
@@ -185,6 +301,71 @@ func (n *NewsSpider) GetNewsLinkRes(linksHandleFunc func(*NewsData), scheme stri
 	return listSlice, nil
 }
 
+// GetSitemapLinkRes 获取 sitemap 中的内容页链接, sitemap 中的新闻标题作为内容页标题
+func (n *NewsSpider) GetSitemapLinkRes(linksHandleFunc func(*NewsData), indexUrl string) {
+	ctx := context.Background()
+	req := n.listReq()
+
+	entries, err := GetSitemapEntries(ctx, indexUrl, req, n.TimeOut)
+	if err != nil {
+		n.wg.Add(1)
+		go linksHandleFunc(&NewsData{nil, 0, indexUrl, err})
+		return
+	}
+
+	domain := ""
+	if u, err := url.Parse(indexUrl); err == nil {
+		domain = extract.DomainTop(u.Hostname())
+	}
+
+	linkData := &LinkData{
+		LinkRes:    SitemapLinkRes(entries, domain, n.SitemapAge),
+		Filters:    map[string]string{},
+		SubDomains: map[string]bool{},
+	}
+	robotsFilter(ctx, linkData, req, n.TimeOut)
+
+	n.wg.Add(1)
+	go linksHandleFunc(&NewsData{linkData, 0, indexUrl, nil})
+}
+
+// GetFeedLinkRes 获取首页声明的 Feed 中的内容页链接, Feed 条目标题作为内容页标题
+func (n *NewsSpider) GetFeedLinkRes(linksHandleFunc func(*NewsData), indexUrl string) {
+	ctx := context.Background()
+	req := n.listReq()
+
+	feeds, err := DiscoverFeeds(ctx, indexUrl, req, n.TimeOut)
+	if err != nil {
+		n.wg.Add(1)
+		go linksHandleFunc(&NewsData{nil, 1, indexUrl, err})
+		return
+	}
+
+	domain := ""
+	if u, err := url.Parse(indexUrl); err == nil {
+		domain = extract.DomainTop(u.Hostname())
+	}
+
+	for _, feedUrl := range feeds {
+		feed, err := GetFeed(ctx, feedUrl, req, n.TimeOut)
+		if err != nil {
+			n.wg.Add(1)
+			go linksHandleFunc(&NewsData{nil, 1, feedUrl, err})
+			continue
+		}
+
+		linkData := &LinkData{
+			LinkRes:    FeedLinkRes(feed, domain),
+			Filters:    map[string]string{},
+			SubDomains: map[string]bool{},
+		}
+		robotsFilter(ctx, linkData, req, n.TimeOut)
+
+		n.wg.Add(1)
+		go linksHandleFunc(&NewsData{linkData, 1, feedUrl, nil})
+	}
+}
+
 // CrawlLinkRes 直接推送列表页内容页
 func (n *NewsSpider) CrawlLinkRes(l *NewsData) {
 	defer n.wg.Done()
@@ -200,8 +381,7 @@ func (n *NewsSpider) CrawlContentNews(l *NewsData) {
 
 	if l.Error == nil {
 		for c, v := range l.LinkRes.Content {
-			if !n.seen[c] {
-				n.seen[c] = true
+			if n.markSeen(c) {
 				cc := map[string]string{}
 				cc[c] = v
 
@@ -212,15 +392,32 @@ func (n *NewsSpider) CrawlContentNews(l *NewsData) {
 	}
 }
 
+// markSeen 标记链接已采集, 已经标记过时返回 false
+func (n *NewsSpider) markSeen(url string) bool {
+	n.seenMu.Lock()
+	defer n.seenMu.Unlock()
+
+	if n.seen[url] {
+		return false
+	}
+	n.seen[url] = true
+
+	return true
+}
+
 // ReqContentNews 获取内容页详情数据
 func (n *NewsSpider) ReqContentNews(content map[string]string) {
 	defer n.wg.Done()
 
-	time.Sleep(time.Duration(fun.RandomInt(10, 100)) * time.Millisecond)
+	// fun.RandomInt 的随机数生成器不能并发使用
+	time.Sleep(time.Duration(rand.Intn(90)+10) * time.Millisecond)
 
 	for url, title := range content {
-		if news, _, err := GetNews(url, title, n.TimeOut, n.RetryTime); err == nil {
+		if news, resp, err := GetNewsWithReq(url, title, n.contentReq(), n.TimeOut, n.RetryTime); err == nil {
 			newsData := &NewsContent{}
+			if resp != nil {
+				newsData.Trace = resp.Trace
+			}
 			newsData.Url = url
 			newsData.Title = news.Title
 			newsData.Content = news.Content
@@ -274,21 +471,26 @@ func (n *NewsSpider) process(processFunc func(...any)) {
 // GetLinkRes 回调获取LinkRes数据
 func (n *NewsSpider) GetLinkRes() {
 	n.GetNews(n.CrawlLinkRes)
-
-	go n.process(n.ProcessFunc)
-
-	n.Wait()
-	defer n.Close()
+	n.processAll()
 }
 
 // GetContentNews 回调获取内容页数据
 func (n *NewsSpider) GetContentNews() {
 	n.GetNews(n.CrawlContentNews)
+	n.processAll()
+}
 
-	go n.process(n.ProcessFunc)
+// processAll 处理所有数据, 最后一条数据处理完成后返回
+func (n *NewsSpider) processAll() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.process(n.ProcessFunc)
+	}()
 
 	n.Wait()
-	defer n.Close()
+	n.Close()
+	<-done
 }
 
 // GetSubdomains 获取subDomain
@@ -300,6 +502,75 @@ func GetSubdomains(url string, req *HttpReq, timeout int, retry int) (map[string
 	}
 }
 
+// listReq 列表页请求体, 使用响应缓存
+func (n *NewsSpider) listReq() *HttpReq {
+	return n.mergeReq(n.Req, 3, n.Cache)
+}
+
+// contentReq 内容页请求体, 未指定采集器级别的配置时与 GetNews 默认请求一致
+func (n *NewsSpider) contentReq() *HttpReq {
+	return n.mergeReq(nil, 2, nil)
+}
+
+// mergeReq 拷贝请求体并合并采集器级别的配置(Fetcher、RetryPolicy、Limiter、Robots、Transport、Proxy、Cache、Jar、Middlewares、Trace), 请求体为空时使用默认配置
+func (n *NewsSpider) mergeReq(req *HttpReq, maxRedirect int, cache CacheStore) *HttpReq {
+	if n.Fetcher == nil && n.RetryPolicy == nil && n.Limiter == nil && n.Robots == nil && n.Transport == TransportDefault && n.Proxy == nil && cache == nil && n.Jar == nil && len(n.Middlewares) == 0 && !n.Trace {
+		return req
+	}
+
+	var r HttpReq
+	if req != nil {
+		r = *req
+	} else {
+		r = HttpReq{
+			HttpReq: &fun.HttpReq{
+				MaxContentLength: HttpDefaultMaxContentLength,
+				MaxRedirect:      maxRedirect,
+			},
+			ForceTextContentType: true,
+		}
+	}
+
+	if n.Fetcher != nil {
+		r.Fetcher = n.Fetcher
+	}
+	if n.RetryPolicy != nil {
+		r.RetryPolicy = n.RetryPolicy
+	}
+	if n.Limiter != nil {
+		r.Limiter = n.Limiter
+	}
+	if n.Robots != nil {
+		r.Robots = n.Robots
+	}
+	if n.Transport != TransportDefault {
+		r.TransportProfile = n.Transport
+	}
+	if n.Proxy != nil {
+		r.Proxy = n.Proxy
+	}
+	if cache != nil {
+		r.Cache = cache
+	}
+	if n.Trace {
+		r.Trace = true
+	}
+	if len(n.Middlewares) > 0 {
+		r.Middlewares = append(append([]Middleware{}, n.Middlewares...), r.Middlewares...)
+	}
+	if n.Jar != nil {
+		// 拷贝嵌入的 fun.HttpReq, 避免修改调用方的请求体
+		var funReq fun.HttpReq
+		if r.HttpReq != nil {
+			funReq = *r.HttpReq
+		}
+		funReq.Jar = n.Jar
+		r.HttpReq = &funReq
+	}
+
+	return &r
+}
+
 // GetIndexUrl 获取首页url
 func GetIndexUrl(url string) (string, string) {
 	urlSlice := strings.Split(url, "/")
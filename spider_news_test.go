@@ -17,11 +17,15 @@ var (
 )
 
 func TestNews_GetLinkRes_Noctx(t *testing.T) {
+	skipOnline(t)
+
 	n := NewNewsSpider(newUrl, 2, processLink, nil, WithRetryTime(1), WithTimeOut(10000))
 	n.GetLinkRes()
 }
 
 func TestNews_GetLinkRes(t *testing.T) {
+	skipOnline(t)
+
 	ctx := "getLinkRes"
 	n := NewNewsSpider(newUrl, 2, processLink, ctx, WithRetryTime(1), WithTimeOut(10000))
 	n.RetryTime = 1
@@ -30,6 +34,8 @@ func TestNews_GetLinkRes(t *testing.T) {
 }
 
 func TestNews_GetLinkRes_Clone(t *testing.T) {
+	skipOnline(t)
+
 	ctx := "getLinkRes"
 	n := NewNewsSpider(newUrl, 2, processLink, ctx)
 
@@ -51,6 +57,8 @@ func processLink(data ...any) {
 }
 
 func TestNews_GetContentNews(t *testing.T) {
+	skipOnline(t)
+
 	ctx := "getContentNews"
 	n := NewNewsSpider(newUrl, 1, processContent, ctx)
 	n.GetContentNews()
@@ -62,6 +70,8 @@ func processContent(data ...any) {
 }
 
 func TestNews_GetNewsWithProxy(t *testing.T) {
+	skipOnline(t)
+
 	transport := &http.Transport{
 		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
 		DisableKeepAlives: true,
@@ -2,7 +2,9 @@ package spider
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -18,6 +20,7 @@ import (
 )
 
 func BenchmarkHtmlParse(b *testing.B) {
+	skipOnline(b)
 
 	resp, _ := fun.HttpGetResp("https://www.163.com", nil, 30000)
 
@@ -29,6 +32,8 @@ func BenchmarkHtmlParse(b *testing.B) {
 }
 
 func TestGoquery(t *testing.T) {
+	skipOnline(t)
+
 	body, _ := HttpGet("https://jp.news.cn/index.htm")
 	doc, _ := goquery.NewDocumentFromReader(bytes.NewReader(body))
 
@@ -88,6 +93,8 @@ func TestCount(t *testing.T) {
 }
 
 func TestGetLinkData(t *testing.T) {
+	skipOnline(t)
+
 	var urlStrs = []string{
 		// "https://www.1905.com",
 		// "https://www.people.com.cn",
@@ -163,6 +170,7 @@ func TestGetLinkData(t *testing.T) {
 }
 
 func TestGetNews(t *testing.T) {
+	skipOnline(t)
 
 	var urlStrs = []string{
 		// "http://www.cankaoxiaoxi.com/finance/20220831/2489264.shtml",
@@ -229,6 +237,8 @@ func TestGetNews(t *testing.T) {
 }
 
 func TestGetNewsWithReq(t *testing.T) {
+	skipOnline(t)
+
 	transport := &http.Transport{
 		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
 		DisableKeepAlives: true,
@@ -284,3 +294,44 @@ func TestDemo(t *testing.T) {
 	t.Log(findString)
 	t.Log(fun.Date(fun.StrToTime("2022-04-10T18:24:00")))
 }
+
+func TestGetNewsCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := GetNewsCtx(ctx, testArticleUrl, "", 10000, 3)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+
+	_, err = GetLinkDataCtx(ctx, testHomeUrl, true, 10000, 3)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+}
+
+func TestGetNewsFromHTML(t *testing.T) {
+	body, _ := fun.Utf8To([]byte(testArticleHtml()), "GBK")
+	headers := http.Header{"Content-Type": []string{"text/html; charset=gbk"}}
+
+	news, err := GetNewsFromHTML(body, &headers, testArticleUrl, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	online, _, _ := GetNewsWithReq(testArticleUrl, "", &HttpReq{Fetcher: newTestFetcher()}, 10000, 1)
+	if news.Title != online.Title || news.Content != online.Content || news.TimeLocal != online.TimeLocal || news.Lang != online.Lang {
+		t.Fatalf("offline news %+v differs from online news %+v", news, online)
+	}
+}
+
+func TestGetLinkDataFromHTML(t *testing.T) {
+	linkData, err := GetLinkDataFromHTML([]byte(testHomeHtml()), nil, testHomeUrl, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(linkData.LinkRes.Content) != 20 {
+		t.Fatalf("want 20 content links, got %d", len(linkData.LinkRes.Content))
+	}
+}
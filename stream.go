@@ -0,0 +1,346 @@
+package spider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/x-funs/go-fun"
+	"golang.org/x/text/transform"
+)
+
+// HttpStreamSniffLength 流式读取时用于探测字符集的响应长度
+const HttpStreamSniffLength = 4096
+
+// HttpStream 流式读取的 Http 响应, 读取时按探测到的字符集转换为 UTF-8, 使用后需要 Close
+// HttpResp.Body 为空, 读取超过最大长度时截断并设置 HttpResp.Truncated
+type HttpStream struct {
+	*HttpResp
+
+	reader  io.Reader
+	closers []io.Closer
+	release func()
+}
+
+// Read 读取 UTF-8 响应体
+func (s *HttpStream) Read(p []byte) (int, error) {
+	// 请求失败但中间件忽略了错误
+	if s.reader == nil {
+		return 0, io.EOF
+	}
+
+	n, err := s.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = withCause(ErrReadBody, err)
+	}
+
+	return n, err
+}
+
+// Close 关闭响应体并释放主机限速器
+func (s *HttpStream) Close() error {
+	var err error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if e := s.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.closers = nil
+
+	if s.release != nil {
+		s.release()
+		s.release = nil
+	}
+
+	return err
+}
+
+// Document 读取响应体并解析为 goquery.Document, 完成后关闭响应体
+func (s *HttpStream) Document() (*goquery.Document, error) {
+	defer s.Close()
+
+	doc, err := goquery.NewDocumentFromReader(s)
+	if err != nil {
+		if errors.Is(err, ErrReadBody) {
+			return nil, err
+		}
+		return nil, ErrDocParse
+	}
+
+	return doc, nil
+}
+
+// HttpGetStream Http Get 流式请求, 参数为请求地址, HttpReq, 超时时间(毫秒)
+// 返回 HttpStream, 错误信息
+func HttpGetStream(urlStr string, r *HttpReq, timeout int) (*HttpStream, error) {
+	return HttpGetStreamCtx(context.Background(), urlStr, r, timeout)
+}
+
+// HttpGetStreamCtx Http Get 流式请求, 参数为 context.Context, 请求地址, HttpReq, 超时时间(毫秒)
+// 返回 HttpStream, 错误信息
+func HttpGetStreamCtx(ctx context.Context, urlStr string, r *HttpReq, timeout int) (*HttpStream, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return HttpDoStreamCtx(ctx, req, r, timeout)
+}
+
+// HttpDoStreamCtx Http 流式请求, 参数为 context.Context, http.Request, HttpReq, 超时时间(毫秒)
+// 根据响应头和前 HttpStreamSniffLength 字节探测字符集, 不使用响应缓存
+// 最大长度为 HttpReq.MaxContentLength, 未设置时为 HttpDefaultMaxContentLength, 超过时截断而不返回错误
+// 请求依次经过全局中间件和 HttpReq.Middlewares, 中间件得到的 HttpResp 即 HttpStream.HttpResp, Body 为空
+// 中间件直接返回或替换的 HttpResp 按 HttpResp.Body 读取
+// 超时时间包括读取响应体的时间, 返回 HttpStream, 错误信息
+func HttpDoStreamCtx(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpStream, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if req.Context() != ctx {
+		req = req.WithContext(ctx)
+	}
+	if r == nil {
+		r = &HttpReq{}
+	}
+
+	var stream *HttpStream
+	handler := func(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpResp, error) {
+		var err error
+		stream, err = httpDoStream(ctx, req, r, timeout)
+		return stream.HttpResp, err
+	}
+	resp, err := chainMiddleware(handler, r)(ctx, req, r, timeout)
+
+	if stream == nil || stream.HttpResp != resp {
+		if stream != nil {
+			_ = stream.Close()
+		}
+		if resp == nil {
+			resp = &HttpResp{}
+		}
+		if resp.HttpResp == nil {
+			resp.HttpResp = &fun.HttpResp{}
+		}
+		stream = &HttpStream{HttpResp: resp, reader: bytes.NewReader(resp.Body)}
+	}
+
+	return stream, err
+}
+
+// httpDoStream 发送 Http 流式请求, 中间件链的最内层
+func httpDoStream(ctx context.Context, req *http.Request, r *HttpReq, timeout int) (*HttpStream, error) {
+	// 请求耗时和网络信息, 关闭响应时记录总耗时
+	var trace *HttpTrace
+	if r.Trace {
+		trace, ctx = newHttpTrace(ctx)
+	}
+	if req.Context() != ctx {
+		req = req.WithContext(ctx)
+	}
+
+	transport := r.transport()
+	if r.HttpReq == nil {
+		r.HttpReq = &fun.HttpReq{}
+	}
+	if r.ForceTextContentType {
+		r.AllowedContentTypes = textContentTypes
+	}
+
+	stream := &HttpStream{HttpResp: &HttpResp{HttpResp: &fun.HttpResp{}, Trace: trace}}
+	if trace != nil {
+		stream.closers = append(stream.closers, traceCloser{trace: trace})
+	}
+
+	// 主机限速, 关闭响应时释放
+	if limiter := r.limiter(); limiter != nil {
+		release, err := limiter.Wait(ctx, req.URL.Hostname())
+		if err != nil {
+			return stream, err
+		}
+		stream.release = release
+	}
+
+	fail := func(err error) (*HttpStream, error) {
+		_ = stream.Close()
+		return stream, err
+	}
+
+	if r.TLS != nil {
+		var err error
+		if transport, err = r.TLS.transport(transport); err != nil {
+			return fail(err)
+		}
+	}
+
+	var proxy *url.URL
+	if r.Proxy != nil {
+		var err error
+		if proxy, err = r.Proxy.Select(req.URL.Hostname()); err != nil {
+			return fail(err)
+		}
+		if transport, err = r.Proxy.transport(transport, proxy); err != nil {
+			return fail(err)
+		}
+		stream.Proxy = proxy.Redacted()
+	}
+
+	recorder := &roundTripRecorder{transport: transport, trace: trace}
+	resp, err := httpSend(req, r.HttpReq, recorder, timeout)
+	stream.Redirects = recorder.redirects
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fail(ctxErr)
+		}
+		if tlsVerifyError(recorder.err) {
+			stream.TLSVerify = TLSError
+			return fail(withCause(ErrTLSVerify, recorder.err))
+		}
+		if proxy != nil {
+			r.Proxy.MarkFailure(proxy)
+		}
+		return fail(withCause(ErrDo, err))
+	}
+	stream.closers = append(stream.closers, resp.Body)
+	if proxy != nil {
+		r.Proxy.MarkSuccess(proxy)
+	}
+
+	stream.StatusCode = resp.StatusCode
+	stream.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	stream.Headers = &resp.Header
+	stream.ContentLength = resp.ContentLength
+	stream.RequestURL = resp.Request.URL
+	stream.TLS = resp.TLS
+	stream.TLSVerify = tlsVerifyResult(resp.TLS)
+
+	if !stream.Success && !r.ReadBodyWithFail {
+		return fail(&StatusError{StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))})
+	}
+
+	if !httpAllowContentType(r.HttpReq, resp.Header) {
+		return fail(ErrContentType)
+	}
+
+	// 解压, 未声明 Content-Encoding 时根据魔数识别
+	body := bufio.NewReader(resp.Body)
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		head, _ := body.Peek(len(zstdMagic))
+		encoding = sniffEncoding(head, resp.Header)
+	}
+	decoder, err := decodeReader(encoding, body)
+	if err != nil {
+		return fail(withCause(ErrGzip, err))
+	}
+	stream.closers = append(stream.closers, decoder)
+	var reader io.Reader = decoder
+
+	// 最大长度
+	maxLength := r.MaxContentLength
+	if maxLength <= 0 {
+		maxLength = HttpDefaultMaxContentLength
+	}
+	reader = &truncateReader{reader: reader, remain: maxLength, truncated: &stream.Truncated}
+
+	// 根据响应头和前 HttpStreamSniffLength 字节探测字符集
+	if !r.DisableCharset {
+		head := make([]byte, HttpStreamSniffLength)
+		n, err := io.ReadFull(reader, head)
+		head = head[:n]
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fail(withCause(ErrReadBody, err))
+		}
+		rest := reader
+
+		// 探测长度截断了多字节字符时去掉不完整的字符, 避免误判为非 UTF-8
+		sniff := head
+		if err == nil {
+			sniff = trimIncompleteRune(head)
+		}
+
+		stream.Charset = Charset(sniff, stream.Headers)
+		unread := err == nil
+
+		// 转换前去掉 BOM
+		if stream.Charset.CharsetPos == CharsetPosBom {
+			_, n := CharsetFromBom(head)
+			head = head[n:]
+		}
+		reader = io.MultiReader(bytes.NewReader(head), rest)
+
+		if stream.Charset.CharsetPos == CharsetPosRepair || (stream.Charset.Charset == "UTF-8" && unread) {
+			// 修复混合编码, 探测部分为有效的 UTF-8 时也需要修复之后出现的其他编码, 有效的 UTF-8 原样输出
+			// RepairedBytes 在读取时累加
+			declared := CharsetFromHeaderHtml(sniff, stream.Headers)
+			stream.Charset.RepairedBytes = 0
+			reader = transform.NewReader(reader, newCharsetRepairTransformer(&stream.Charset, declared))
+		} else if c := stream.Charset.Charset; c != "" && c != "UTF-8" {
+			e, err := charsetEncoding(c)
+			if err != nil {
+				return fail(ErrCharset)
+			}
+			reader = transform.NewReader(reader, e.NewDecoder())
+		}
+	}
+
+	stream.reader = reader
+
+	return stream, nil
+}
+
+// truncateProbeReads 判断是否截断时最多连续读取的次数, 与 bufio 对连续空读取的处理一致
+const truncateProbeReads = 100
+
+// truncateReader 最多读取 remain 字节, 超过时设置 truncated
+type truncateReader struct {
+	reader    io.Reader
+	remain    int64
+	truncated *bool
+}
+
+func (t *truncateReader) Read(p []byte) (int, error) {
+	if t.remain <= 0 {
+		// 再读取一个字节判断是否还有数据, Read 可能返回 (0, nil), 需要读到数据或错误为止
+		var b [1]byte
+		for i := 0; i < truncateProbeReads; i++ {
+			n, err := t.reader.Read(b[:])
+			if n > 0 {
+				*t.truncated = true
+			}
+			if n > 0 || err != nil {
+				break
+			}
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > t.remain {
+		p = p[:t.remain]
+	}
+	n, err := t.reader.Read(p)
+	t.remain -= int64(n)
+
+	return n, err
+}
+
+// trimIncompleteRune 去掉末尾不完整的 UTF-8 字符
+func trimIncompleteRune(b []byte) []byte {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i]
+			}
+			break
+		}
+	}
+
+	return b
+}
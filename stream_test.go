@@ -0,0 +1,153 @@
+package spider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/x-funs/go-fun"
+)
+
+func TestHttpGetStream(t *testing.T) {
+	// 字符集声明在探测长度内, 正文为 GBK
+	html := `<html><head><meta charset="gbk"><title>示例新闻网</title></head><body>` + strings.Repeat("<p>中国</p>", 2000) + `</body></html>`
+	gbk, _ := fun.Utf8To([]byte(html), "gbk")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			gw := gzip.NewWriter(w)
+			_, _ = gw.Write(gbk)
+			_ = gw.Close()
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		case "/404":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			_, _ = w.Write(gbk)
+		}
+	}))
+	defer ts.Close()
+
+	for _, path := range []string{"/", "/gzip"} {
+		stream, err := HttpGetStream(ts.URL+path, nil, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(stream)
+		_ = stream.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != html || stream.Charset.Charset != "GBK" || stream.Truncated {
+			t.Errorf("%s unexpected charset %+v truncated %v", path, stream.Charset, stream.Truncated)
+		}
+	}
+
+	// 超过最大长度时截断
+	stream, err := HttpGetStream(ts.URL, &HttpReq{HttpReq: &fun.HttpReq{MaxContentLength: 1000}}, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := stream.Document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stream.Truncated || doc.Find("title").Text() != "示例新闻网" {
+		t.Errorf("want truncated document, got %v %s", stream.Truncated, doc.Find("title").Text())
+	}
+
+	// 刚好等于最大长度时不截断
+	stream, _ = HttpGetStream(ts.URL, &HttpReq{HttpReq: &fun.HttpReq{MaxContentLength: int64(len(gbk))}}, 5000)
+	if _, err := io.Copy(io.Discard, stream); err != nil || stream.Truncated {
+		t.Errorf("want not truncated, got %v %v", stream.Truncated, err)
+	}
+	_ = stream.Close()
+
+	if _, err := HttpGetStream(ts.URL+"/image", &HttpReq{ForceTextContentType: true}, 5000); !errors.Is(err, ErrContentType) {
+		t.Errorf("want ErrContentType, got %v", err)
+	}
+	if _, err := HttpGetStream(ts.URL+"/404", nil, 5000); !errors.Is(err, ErrStatusCode) {
+		t.Errorf("want ErrStatusCode, got %v", err)
+	}
+}
+
+func TestTrimIncompleteRune(t *testing.T) {
+	b := []byte("中国")
+	if got := trimIncompleteRune(b[:5]); !bytes.Equal(got, b[:3]) {
+		t.Errorf("want %v, got %v", b[:3], got)
+	}
+	if got := trimIncompleteRune(b); !bytes.Equal(got, b) {
+		t.Errorf("want %v, got %v", b, got)
+	}
+}
+
+// emptyReadReader 每次有数据的读取之前先返回 (0, nil)
+type emptyReadReader struct {
+	reader io.Reader
+	empty  bool
+}
+
+func (r *emptyReadReader) Read(p []byte) (int, error) {
+	if r.empty = !r.empty; r.empty {
+		return 0, nil
+	}
+
+	return r.reader.Read(p)
+}
+
+func TestTruncateReader(t *testing.T) {
+	for _, c := range []struct {
+		body      string
+		truncated bool
+	}{
+		{"0123456789", false},
+		{"0123456789a", true},
+	} {
+		var truncated bool
+		reader := &truncateReader{reader: &emptyReadReader{reader: strings.NewReader(c.body)}, remain: 10, truncated: &truncated}
+		body, err := io.ReadAll(reader)
+		if err != nil || string(body) != "0123456789" || truncated != c.truncated {
+			t.Errorf("%s want truncated %v, got %s %v %v", c.body, c.truncated, body, truncated, err)
+		}
+	}
+}
+
+func TestHttpSendSameAsStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.Header.Get("User-Agent") + "|" + r.Header.Get("Accept-Encoding") + "|" + r.Header.Get("X-Test")))
+	}))
+	defer ts.Close()
+
+	for _, r := range []*HttpReq{
+		nil,
+		{HttpReq: &fun.HttpReq{UserAgent: "spider", Headers: map[string]string{"X-Test": "1", "Accept-Encoding": "gzip"}}},
+		{HttpReq: &fun.HttpReq{DisableRedirect: true, ReadBodyWithFail: true}},
+	} {
+		// ReadBodyWithFail 时非 2xx 响应同时返回 body 和错误
+		resp, _ := HttpGetResp(ts.URL+"/redirect", r, 5000)
+
+		stream, streamErr := HttpGetStream(ts.URL+"/redirect", r, 5000)
+		if streamErr != nil {
+			t.Fatal(streamErr)
+		}
+		body, _ := io.ReadAll(stream)
+		_ = stream.Close()
+
+		if string(resp.Body) != string(body) || resp.StatusCode != stream.StatusCode {
+			t.Errorf("want same response, got %d %q and %d %q", resp.StatusCode, resp.Body, stream.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package spider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// TLSVerifyResult TLS 证书校验结果
+type TLSVerifyResult int
+
+const (
+	// TLSNone 非 TLS 请求
+	TLSNone TLSVerifyResult = iota
+
+	// TLSVerified 证书校验通过
+	TLSVerified
+
+	// TLSSkipped 跳过了证书校验
+	TLSSkipped
+
+	// TLSError 证书校验失败
+	TLSError
+)
+
+func (r TLSVerifyResult) String() string {
+	switch r {
+	case TLSVerified:
+		return "verified"
+	case TLSSkipped:
+		return "skipped"
+	case TLSError:
+		return "error"
+	default:
+		return "none"
+	}
+}
+
+// TLSConfig TLS 配置, HttpReq.TLS 为空时与 HttpDefaultTransport 一样不校验证书
+// 仅在 Transport 为 *http.Transport 时生效, 会基于该 Transport 复制并缓存新的 Transport, 其他 RoundTripper 请求时返回 ErrTLSVerify
+type TLSConfig struct {
+	// 校验服务端证书
+	Verify bool
+
+	// 根证书, 为空时使用系统根证书
+	RootCAs *x509.CertPool
+
+	// 客户端证书
+	Certificates []tls.Certificate
+
+	// 最低 TLS 版本, 如 tls.VersionTLS12
+	MinVersion uint16
+
+	// 覆盖 SNI 和校验使用的服务端名称
+	ServerName string
+
+	mu         sync.Mutex
+	transports map[*http.Transport]*http.Transport
+}
+
+// Config 返回对应的 tls.Config
+func (c *TLSConfig) Config() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: !c.Verify,
+		RootCAs:            c.RootCAs,
+		Certificates:       c.Certificates,
+		MinVersion:         c.MinVersion,
+		ServerName:         c.ServerName,
+	}
+}
+
+// transport 返回使用该 TLS 配置的 Transport
+// 只有 *http.Transport 可以设置 TLS 配置, base 为其他 RoundTripper 时返回 ErrTLSVerify, 避免在未校验证书的情况下请求
+func (c *TLSConfig) transport(base http.RoundTripper) (http.RoundTripper, error) {
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, ErrTLSVerify
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.transports == nil {
+		c.transports = make(map[*http.Transport]*http.Transport)
+	}
+	if transport, exists := c.transports[t]; exists {
+		return transport, nil
+	}
+
+	transport := t.Clone()
+	transport.TLSClientConfig = c.Config()
+	c.transports[t] = transport
+
+	return transport, nil
+}
+
+// NewCertPool 从 PEM 文件加载根证书
+func NewCertPool(pemFiles ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range pemFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, ErrTLSVerify
+		}
+	}
+
+	return pool, nil
+}
+
+// tlsVerifyResult 根据 TLS 连接状态返回校验结果
+func tlsVerifyResult(state *tls.ConnectionState) TLSVerifyResult {
+	if state == nil {
+		return TLSNone
+	}
+	if len(state.VerifiedChains) > 0 {
+		return TLSVerified
+	}
+
+	return TLSSkipped
+}
+
+// tlsVerifyError 判断是否是证书校验错误
+func tlsVerifyError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	return errors.As(err, &verifyErr) || errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
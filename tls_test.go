@@ -0,0 +1,105 @@
+package spider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/x-funs/go-fun"
+)
+
+func newTestTLSServer(clientAuth tls.ClientAuthType) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>tls</body></html>"))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: clientAuth}
+	ts.StartTLS()
+
+	return ts
+}
+
+func TestHttpGetRespTLS(t *testing.T) {
+	ts := newTestTLSServer(tls.NoClientCert)
+	defer ts.Close()
+
+	// 默认不校验证书
+	resp, err := HttpGetResp(ts.URL, nil, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TLSVerify != TLSSkipped || resp.TLS == nil {
+		t.Errorf("want skipped, got %v", resp.TLSVerify)
+	}
+
+	// 校验证书, 未信任的根证书
+	resp, err = HttpGetResp(ts.URL, &HttpReq{TLS: &TLSConfig{Verify: true}}, 5000)
+	if !errors.Is(err, ErrTLSVerify) || resp.TLSVerify != TLSError {
+		t.Errorf("want ErrTLSVerify, got %v %v", err, resp.TLSVerify)
+	}
+	if RetryableError(err) {
+		t.Error("want TLS verify error not retryable")
+	}
+
+	// 自定义根证书和 SNI
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	for _, serverName := range []string{"", "example.com"} {
+		req := &HttpReq{TLS: &TLSConfig{Verify: true, RootCAs: roots, MinVersion: tls.VersionTLS12, ServerName: serverName}}
+		resp, err = HttpGetResp(ts.URL, req, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.TLSVerify != TLSVerified || resp.TLS.ServerName != serverName {
+			t.Errorf("want verified with %q, got %v %q", serverName, resp.TLSVerify, resp.TLS.ServerName)
+		}
+	}
+
+	// 服务端名称不匹配
+	req := &HttpReq{TLS: &TLSConfig{Verify: true, RootCAs: roots, ServerName: "www.other.com"}}
+	if _, err = HttpGetResp(ts.URL, req, 5000); !errors.Is(err, ErrTLSVerify) {
+		t.Errorf("want ErrTLSVerify, got %v", err)
+	}
+
+	// 非 TLS 请求
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+	}))
+	defer plain.Close()
+	if resp, err = HttpGetResp(plain.URL, &HttpReq{TLS: &TLSConfig{Verify: true}}, 5000); err != nil || resp.TLSVerify != TLSNone {
+		t.Errorf("want none, got %v %v", resp.TLSVerify, err)
+	}
+}
+
+func TestHttpGetRespTLSRoundTripper(t *testing.T) {
+	ts := newTestTLSServer(tls.NoClientCert)
+	defer ts.Close()
+
+	// 不是 *http.Transport 时无法校验证书
+	req := &HttpReq{HttpReq: &fun.HttpReq{Transport: testRoundTripper{}}, TLS: &TLSConfig{Verify: true}}
+	if _, err := HttpGetResp(ts.URL, req, 5000); !errors.Is(err, ErrTLSVerify) {
+		t.Errorf("want ErrTLSVerify, got %v", err)
+	}
+	if stream, err := HttpGetStream(ts.URL, req, 5000); !errors.Is(err, ErrTLSVerify) {
+		t.Errorf("want ErrTLSVerify from stream, got %v", err)
+	} else {
+		_ = stream.Close()
+	}
+}
+
+func TestHttpGetRespClientCert(t *testing.T) {
+	ts := newTestTLSServer(tls.RequireAnyClientCert)
+	defer ts.Close()
+
+	if _, err := HttpGetResp(ts.URL, &HttpReq{TLS: &TLSConfig{}}, 5000); !errors.Is(err, ErrDo) {
+		t.Errorf("want ErrDo without client cert, got %v", err)
+	}
+
+	req := &HttpReq{TLS: &TLSConfig{Certificates: ts.TLS.Certificates}}
+	if _, err := HttpGetResp(ts.URL, req, 5000); err != nil {
+		t.Errorf("want success with client cert, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package spider
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// HttpTrace 请求耗时和网络信息, 设置 HttpReq.Trace 后记录
+// 发生跳转时 DNS、Connect、TLS 为各次请求的累计耗时, FirstByte 为最后一次请求的首字节耗时
+type HttpTrace struct {
+	// DNS 解析耗时
+	DNS time.Duration
+
+	// TCP 连接耗时
+	Connect time.Duration
+
+	// TLS 握手耗时
+	TLS time.Duration
+
+	// 从获取连接到收到响应首字节的耗时
+	FirstByte time.Duration
+
+	// 总耗时, 包括读取响应体, 流式请求在 Close 时记录
+	Total time.Duration
+
+	// 读取的响应体字节数(解压前), 包括跳转响应
+	BytesRead int64
+
+	// 最后一次请求的服务端地址
+	RemoteAddr string
+
+	// 最后一次请求是否复用了连接
+	Reused bool
+
+	// 请求链, 包括跳转和最后一次请求, 跳转详情见 HttpResp.Redirects
+	Requests []HttpTraceRequest
+
+	mu        sync.Mutex
+	start     time.Time
+	connStart time.Time
+	dnsStart  time.Time
+	dialStart time.Time
+	tlsStart  time.Time
+}
+
+// HttpTraceRequest 请求链中的一次请求
+type HttpTraceRequest struct {
+	// 请求地址
+	Url string
+
+	// Http 状态码, 请求失败时为 0
+	StatusCode int
+}
+
+// newHttpTrace 初始化 HttpTrace 并返回带有 httptrace.ClientTrace 的 context
+func newHttpTrace(ctx context.Context) (*HttpTrace, context.Context) {
+	t := &HttpTrace{start: time.Now()}
+
+	return t, httptrace.WithClientTrace(ctx, t.clientTrace())
+}
+
+func (t *HttpTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			t.connStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.DNS += time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			// 同时尝试多个地址时从第一次开始计算
+			t.mu.Lock()
+			if t.dialStart.IsZero() {
+				t.dialStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			if err == nil && !t.dialStart.IsZero() {
+				t.Connect += time.Since(t.dialStart)
+				t.dialStart = time.Time{}
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.TLS += time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			if info.Conn != nil {
+				t.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+			t.Reused = info.Reused
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.FirstByte = time.Since(t.connStart)
+			t.mu.Unlock()
+		},
+	}
+}
+
+// roundTrip 记录请求链, 并统计读取的响应体字节数
+func (t *HttpTrace) roundTrip(req *http.Request, resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	request := HttpTraceRequest{Url: req.URL.String()}
+	if resp != nil {
+		request.StatusCode = resp.StatusCode
+		resp.Body = &traceBody{ReadCloser: resp.Body, trace: t}
+	}
+	t.Requests = append(t.Requests, request)
+}
+
+// done 请求结束, 记录总耗时
+func (t *HttpTrace) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Total = time.Since(t.start)
+}
+
+// traceBody 统计读取的响应体字节数
+type traceBody struct {
+	io.ReadCloser
+	trace *HttpTrace
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.trace.mu.Lock()
+	b.trace.BytesRead += int64(n)
+	b.trace.mu.Unlock()
+
+	return n, err
+}
+
+// traceCloser 关闭流式响应时记录总耗时
+type traceCloser struct {
+	trace *HttpTrace
+}
+
+func (c traceCloser) Close() error {
+	c.trace.done()
+
+	return nil
+}
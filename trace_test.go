@@ -0,0 +1,80 @@
+package spider
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpGetRespTrace(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/news/", http.StatusFound)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(testHomeHtml()))
+	}))
+	defer ts.Close()
+
+	resp, err := HttpGetResp(ts.URL, &HttpReq{Trace: true}, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trace := resp.Trace
+	if trace == nil {
+		t.Fatal("want trace")
+	}
+	if len(trace.Requests) != 2 || trace.Requests[0].StatusCode != http.StatusFound ||
+		trace.Requests[1].Url != ts.URL+"/news/" || trace.Requests[1].StatusCode != http.StatusOK {
+		t.Errorf("unexpected requests %+v", trace.Requests)
+	}
+	if trace.FirstByte < 20*time.Millisecond || trace.Total < trace.FirstByte || trace.Connect <= 0 {
+		t.Errorf("unexpected timing first byte %v total %v connect %v", trace.FirstByte, trace.Total, trace.Connect)
+	}
+	if trace.RemoteAddr != ts.Listener.Addr().String() || trace.BytesRead < int64(len(testHomeHtml())) {
+		t.Errorf("unexpected remote addr %s bytes read %d", trace.RemoteAddr, trace.BytesRead)
+	}
+
+	// 未设置时不记录
+	if resp, _ := HttpGetResp(ts.URL, nil, 5000); resp.Trace != nil {
+		t.Errorf("want no trace")
+	}
+
+	// 流式请求在 Close 时记录总耗时
+	stream, err := HttpGetStream(ts.URL, &HttpReq{Trace: true}, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.ReadAll(stream)
+	_ = stream.Close()
+	if stream.Trace == nil || len(stream.Trace.Requests) != 2 || stream.Trace.Total < stream.Trace.FirstByte ||
+		stream.Trace.BytesRead < int64(len(testHomeHtml())) {
+		t.Errorf("unexpected stream trace %+v", stream.Trace)
+	}
+
+	linkData, err := GetLinkDataWithReq(ts.URL, true, &HttpReq{Trace: true}, 5000, 1)
+	if err != nil || linkData.Trace == nil || len(linkData.Trace.Requests) != 2 {
+		t.Errorf("want trace on LinkData, got %v", err)
+	}
+}
+
+func TestHttpGetRespTraceTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+
+	resp, err := HttpGetResp(ts.URL, &HttpReq{Trace: true}, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Trace.TLS <= 0 || resp.Trace.Reused {
+		t.Errorf("unexpected tls %v reused %v", resp.Trace.TLS, resp.Trace.Reused)
+	}
+}
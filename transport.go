@@ -0,0 +1,95 @@
+package spider
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportProfile HttpReq.Transport 为空时使用的 Transport 配置
+type TransportProfile int
+
+const (
+	// TransportDefault 使用 HttpDefaultTransport, 每次请求新建连接
+	TransportDefault TransportProfile = iota
+
+	// TransportPooled 使用 HttpPooledTransport, 复用连接并支持 HTTP/2
+	TransportPooled
+)
+
+// TransportOptions http.Transport 配置
+type TransportOptions struct {
+	// 连接超时
+	DialTimeout time.Duration
+
+	// TCP KeepAlive 间隔
+	KeepAlive time.Duration
+
+	// TLS 握手超时
+	TLSHandshakeTimeout time.Duration
+
+	// 禁止连接复用
+	DisableKeepAlives bool
+
+	// 最大空闲连接数
+	MaxIdleConns int
+
+	// 每个主机最大空闲连接数
+	MaxIdleConnsPerHost int
+
+	// 每个主机最大连接数, 0 时不限制
+	MaxConnsPerHost int
+
+	// 空闲连接超时
+	IdleConnTimeout time.Duration
+
+	// 启用 HTTP/2
+	HTTP2 bool
+}
+
+// DefaultPooledTransportOptions HttpPooledTransport 的默认配置
+var DefaultPooledTransportOptions = TransportOptions{
+	DialTimeout:         5 * time.Second,
+	KeepAlive:           30 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+	MaxIdleConns:        256,
+	MaxIdleConnsPerHost: 8,
+	IdleConnTimeout:     90 * time.Second,
+	HTTP2:               true,
+}
+
+// HttpPooledTransport 复用连接的 http.Transport, NewsSpider 默认使用
+var HttpPooledTransport = NewHttpTransport(DefaultPooledTransportOptions)
+
+// NewHttpTransport 根据配置初始化 http.Transport, 与 HttpDefaultTransport 一样不校验证书
+func NewHttpTransport(o TransportOptions) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   o.DialTimeout,
+			KeepAlive: o.KeepAlive,
+		}).DialContext,
+		DisableKeepAlives:     o.DisableKeepAlives,
+		MaxIdleConns:          o.MaxIdleConns,
+		MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       o.MaxConnsPerHost,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		TLSHandshakeTimeout:   o.TLSHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     o.HTTP2,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+	}
+}
+
+// transport 返回 HttpReq 使用的 Transport, 未指定时根据 TransportProfile 选择
+func (r *HttpReq) transport() http.RoundTripper {
+	if r != nil && r.HttpReq != nil && r.Transport != nil {
+		return r.Transport
+	}
+
+	if r != nil && r.TransportProfile == TransportPooled {
+		return HttpPooledTransport
+	}
+
+	return HttpDefaultTransport
+}